@@ -13,16 +13,44 @@ type Config struct {
 }
 
 type Options struct {
-	GrpcServer  string  `yaml:"grpc_server"`
-	RetryDelay  []int   `yaml:"retry_delay"`
-	ReserveFees float64 `yaml:"reserve_fees"`
-	TxFee       float64 `yaml:"tx_fee"`
+	GrpcServer     string  `yaml:"grpc_server"`
+	RetryDelay     []int   `yaml:"retry_delay"`
+	ReserveFees    float64 `yaml:"reserve_fees"`
+	TxFee          float64 `yaml:"tx_fee"`
+	ConfirmTimeout int     `yaml:"confirm_timeout"`
+	Timezone       string  `yaml:"timezone"`
+	StateFile      string  `yaml:"state_file"`
+	CatchUpWindow  string  `yaml:"catch_up_window"`
+	MaxConcurrent  int     `yaml:"max_concurrent"`
 }
 
 type Pipline struct {
 	Name    string   `yaml:"name"`
 	Reward  Reward   `yaml:"reward"`
 	Actions []Action `yaml:"actions"`
+	Filter  `yaml:",inline"`
+}
+
+type Filter struct {
+	ExcludeAccounts   []string `yaml:"exclude_accounts"`
+	ExcludeValidators []string `yaml:"exclude_validators"`
+	IncludeOnly       []string `yaml:"include_only"`
+}
+
+// Merge returns the pipline filter combined with an action filter. The exclude
+// lists are joined, the action include_only list replaces the pipline one if set.
+func (f Filter) Merge(actionFilter Filter) Filter {
+	merged := Filter{
+		ExcludeAccounts:   append(append([]string{}, f.ExcludeAccounts...), actionFilter.ExcludeAccounts...),
+		ExcludeValidators: append(append([]string{}, f.ExcludeValidators...), actionFilter.ExcludeValidators...),
+		IncludeOnly:       f.IncludeOnly,
+	}
+
+	if len(actionFilter.IncludeOnly) > 0 {
+		merged.IncludeOnly = actionFilter.IncludeOnly
+	}
+
+	return merged
 }
 
 type Reward struct {
@@ -35,9 +63,65 @@ type Wallet struct {
 }
 
 type Action struct {
-	Type    string   `yaml:"type"`
-	Time    []string `yaml:"time"`
-	Targets []string `yaml:"targets"`
+	Type                 string             `yaml:"type"`
+	Name                 string             `yaml:"name"`
+	DependsOn            []string           `yaml:"depends_on"`
+	Time                 []string           `yaml:"time"`
+	Every                string             `yaml:"every"`
+	EveryBlocks          uint32             `yaml:"every_blocks"`
+	WhenBalanceAbove     float64            `yaml:"when_balance_above"`
+	BalanceScope         string             `yaml:"balance_scope"`
+	MinInterval          string             `yaml:"min_interval"`
+	Timezone             string             `yaml:"timezone"`
+	Jitter               string             `yaml:"jitter"`
+	Targets              []Target           `yaml:"targets"`
+	TargetsFile          string             `yaml:"targets_file"`
+	ValidatorWallets     []Wallet           `yaml:"validator_wallets"`
+	Conditions           Conditions         `yaml:"conditions"`
+	RewardAccount        string             `yaml:"reward_account"`
+	Destination          string             `yaml:"destination"`
+	Floor                float64            `yaml:"floor"`
+	MaxPerRun            float64            `yaml:"max_per_run"`
+	Collector            string             `yaml:"collector"`
+	Tolerance            float64            `yaml:"tolerance"`
+	StateFile            string             `yaml:"state_file"`
+	MinStake             float64            `yaml:"min_stake"`
+	MaxStake             float64            `yaml:"max_stake"`
+	NearMaxGap           float64            `yaml:"near_max_gap"`
+	Strategy             string             `yaml:"strategy"`
+	Weights              map[string]float64 `yaml:"weights"`
+	MinAvailabilityScore float64            `yaml:"min_availability_score"`
+	SortByScore          bool               `yaml:"sort_by_score"`
+	DeferInCommittee     bool               `yaml:"defer_in_committee"`
+	CommitteeDeadline    string             `yaml:"committee_deadline"`
+	Memo                 string             `yaml:"memo"`
+	LockTimeOffset       uint32             `yaml:"lock_time_offset"`
+	FeePolicy            string             `yaml:"fee_policy"`
+	MinFee               float64            `yaml:"min_fee"`
+	MaxFee               float64            `yaml:"max_fee"`
+	Filter               `yaml:",inline"`
+}
+
+// Target is a wallet file path, a target list file or a validator address,
+// or a mapping with the validator address and public key.
+type Target struct {
+	Path      string `yaml:"-"`
+	Address   string `yaml:"address"`
+	PublicKey string `yaml:"public_key"`
+}
+
+func (t *Target) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.Path)
+	}
+
+	type plain Target
+
+	return value.Decode((*plain)(t))
+}
+
+type Conditions struct {
+	AvailabilityScoreBelow float64 `yaml:"availability_score_below"`
 }
 
 func LoadFromFile(file string) (*Config, error) {
@@ -57,5 +141,9 @@ func LoadFromFile(file string) (*Config, error) {
 		config.Options.ReserveFees = 0.01
 	}
 
+	if config.Options.ConfirmTimeout <= 0 {
+		config.Options.ConfirmTimeout = 60
+	}
+
 	return &config, nil
 }
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	// embedded zone database for hosts without one, used by the timezone options
+	_ "time/tzdata"
 
 	"github.com/frimin/pactus-staker/config"
 	"github.com/frimin/pactus-staker/pipline"
+	"github.com/frimin/pactus-staker/pipline/provider"
 	"github.com/urfave/cli/v2"
 )
 
@@ -32,12 +39,27 @@ func main() {
 						log.Fatalf("Unable to load the config: %s", err)
 					}
 
-					e, err := pipline.CreateExecutor(conf)
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+
+					context.AfterFunc(ctx, func() {
+						// a second signal kills the process right away
+						stop()
+						log.Printf("Shutting down, waiting for the running actions to finish their current transaction")
+					})
+
+					e, err := pipline.CreateExecutor(ctx, conf, provider.SystemClock{})
 					if err != nil {
 						log.Fatalf("Unable to create the pipline executor: %s", err)
 					}
 
-					return e.Run()
+					err = e.Run(ctx)
+					if errors.Is(err, context.Canceled) {
+						log.Printf("Shut down")
+						return nil
+					}
+
+					return err
 				},
 			},
 			{
@@ -58,7 +80,7 @@ func main() {
 						log.Fatalf("Unable to load the config: %s", err)
 					}
 
-					e, err := pipline.CreateExecutor(conf)
+					e, err := pipline.CreateExecutor(c.Context, conf, provider.SystemClock{})
 					if err != nil {
 						log.Fatalf("Unable to create the pipline executor: %s", err)
 					}
@@ -73,6 +95,40 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "import",
+				Usage: "check a validator csv file (address, public_key, label, weight) and write it as a targets_file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "input",
+						Aliases: []string{"i"},
+						Value:   "validators.csv",
+						Usage:   "input csv file path",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "targets.csv",
+						Usage:   "output csv file path",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					configPath := c.String("config")
+					conf, err := config.LoadFromFile(configPath)
+					if err != nil {
+						log.Fatalf("Unable to load the config: %s", err)
+					}
+
+					outputFile := c.String("output")
+					err = pipline.ImportTargetsCsv(conf.Options, c.String("input"), outputFile)
+					if err != nil {
+						log.Fatalf("Failed to import validators from CSV: %s", err)
+					}
+
+					log.Printf("Successfully imported validator targets to %s", outputFile)
+					return nil
+				},
+			},
 		},
 		DefaultCommand: "run",
 	}
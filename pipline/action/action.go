@@ -5,14 +5,21 @@ import (
 
 	"github.com/frimin/pactus-staker/config"
 	"github.com/frimin/pactus-staker/pipline/action/bond"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/action/consolidate"
+	"github.com/frimin/pactus-staker/pipline/action/rebalance"
+	"github.com/frimin/pactus-staker/pipline/action/transfer"
+	"github.com/frimin/pactus-staker/pipline/action/unbond"
+	"github.com/frimin/pactus-staker/pipline/action/withdraw"
 	"github.com/frimin/pactus-staker/pipline/provider"
 )
 
 type Action interface {
-	Run() error
-	GetTime() []string
+	Run(runID string) error
 	GetName() string
 	GetValidatorAddresses() []string
+	// GetFilter returns the accounts and validators the action may use
+	GetFilter() *common.Filter
 }
 
 func CreateAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (Action, error) {
@@ -23,6 +30,36 @@ func CreateAction(pipline provider.PiplineProvider, index int, optionsConfig *co
 			return nil, fmt.Errorf("error creating bond action: %w", err)
 		}
 		return rewardAction, nil
+	case "unbond":
+		unbondAction, err := unbond.CreateUnbondAction(pipline, index, optionsConfig, actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating unbond action: %w", err)
+		}
+		return unbondAction, nil
+	case "withdraw":
+		withdrawAction, err := withdraw.CreateWithdrawAction(pipline, index, optionsConfig, actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating withdraw action: %w", err)
+		}
+		return withdrawAction, nil
+	case "transfer":
+		transferAction, err := transfer.CreateTransferAction(pipline, index, optionsConfig, actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating transfer action: %w", err)
+		}
+		return transferAction, nil
+	case "consolidate":
+		consolidateAction, err := consolidate.CreateConsolidateAction(pipline, index, optionsConfig, actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating consolidate action: %w", err)
+		}
+		return consolidateAction, nil
+	case "rebalance":
+		rebalanceAction, err := rebalance.CreateRebalanceAction(pipline, index, optionsConfig, actionConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating rebalance action: %w", err)
+		}
+		return rebalanceAction, nil
 	default:
 		return nil, fmt.Errorf("unknown action type: %s", actionConfig.Type)
 	}
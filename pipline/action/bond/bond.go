@@ -1,27 +1,37 @@
 package bond
 
 import (
-	"context"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
 	"github.com/frimin/pactus-staker/pipline/provider"
 	"github.com/pactus-project/pactus/types/amount"
 	"github.com/pactus-project/pactus/wallet"
-	wallettypes "github.com/pactus-project/pactus/wallet/types"
 	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
 )
 
 type BondAction struct {
-	validatorAddresses   []string
-	validatorWallet      map[string]*wallet.Wallet
-	validatorAddressInfo map[string]wallettypes.AddressInfo
-	pipline              provider.PiplineProvider
-	time                 []string
-	reserveFees          amount.Amount
-	txFee                amount.Amount
+	validatorAddresses []string
+	publicKeys         map[string]string
+	pipline            provider.PiplineProvider
+	txTemplate         *common.TxTemplate
+	reserveFees        amount.Amount
+	fees               *common.FeePolicy
+	confirmTimeout     time.Duration
+	limits             *StakeLimits
+	strategy           Strategy
+	weights            map[string]float64
+	filter             *common.Filter
+	minAvailability    float64
+	sortByScore        bool
+	deferInCommittee   bool
+	committeeDeadline  time.Duration
+	// deferredSince is when a run first deferred bonds, by run ID
+	deferredSince map[string]time.Time
 }
 
 func CreateBondAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*BondAction, error) {
@@ -31,49 +41,85 @@ func CreateBondAction(pipline provider.PiplineProvider, index int, optionsConfig
 		return nil, fmt.Errorf("failed to create reserve fees: %w", err)
 	}
 
-	txFee, err := amount.NewAmount(optionsConfig.TxFee)
+	fees, err := common.CreateFeePolicy(pipline, optionsConfig, actionConfig)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create tx fee: %w", err)
+		return nil, err
 	}
 
-	action := &BondAction{
-		validatorAddresses:   make([]string, 0),
-		validatorWallet:      make(map[string]*wallet.Wallet),
-		validatorAddressInfo: make(map[string]wallettypes.AddressInfo),
-		pipline:              pipline,
-		time:                 actionConfig.Time,
-		reserveFees:          reserveFees,
-		txFee:                txFee,
+	limits, err := CreateStakeLimits(pipline.GetConsensusParams(), actionConfig)
+
+	if err != nil {
+		return nil, err
 	}
 
-	processedAddresses := map[string]bool{}
+	for address, weight := range actionConfig.Weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("negative weight for target %s: %v", address, weight)
+		}
+	}
 
-	for _, target := range actionConfig.Targets {
-		wlt, err := wallet.Open(context.Background(), target)
+	strategy, err := CreateStrategy(actionConfig.Strategy, limits, reserveFees)
 
-		if err != nil {
-			log.Printf("Failed to open wallet: %v", err)
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		for _, address := range wlt.ListAddresses(wallet.OnlyValidatorAddresses()) {
-			if _, ok := processedAddresses[address.Address]; ok {
-				log.Printf("ignore duplicate target address: %s", address.Address)
-				continue
-			}
+	committeeDeadline, err := parseCommitteeDeadline(actionConfig.CommitteeDeadline)
 
-			action.validatorAddresses = append(action.validatorAddresses, address.Address)
-			processedAddresses[address.Address] = true
+	if err != nil {
+		return nil, err
+	}
 
-			action.validatorWallet[address.Address] = wlt
+	targets, err := common.LoadTargets(actionConfig.Targets, actionConfig.TargetsFile)
 
-			for _, address := range wlt.ListAddresses(wallet.OnlyValidatorAddresses()) {
-				action.validatorAddressInfo[address.Address] = address
-			}
-		}
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &BondAction{
+		validatorAddresses: targets.Addresses,
+		publicKeys:         targets.PublicKeys,
+		pipline:            pipline,
+		txTemplate:         txTemplate,
+		reserveFees:        reserveFees,
+		fees:               fees,
+		confirmTimeout:     txTemplate.ConfirmTimeout(time.Duration(optionsConfig.ConfirmTimeout) * time.Second),
+		limits:             limits,
+		strategy:           strategy,
+		weights:            targets.Weights,
+		minAvailability:    actionConfig.MinAvailabilityScore,
+		sortByScore:        actionConfig.SortByScore,
+		deferInCommittee:   actionConfig.DeferInCommittee,
+		committeeDeadline:  committeeDeadline,
+		deferredSince:      make(map[string]time.Time),
+	}
+
+	// weights of the action config override the ones of the target lists
+	for address, weight := range actionConfig.Weights {
+		action.weights[address] = weight
+	}
+
+	labels := pipline.GetAddressLabels()
+
+	common.AddLabels(labels, targets)
+
+	action.filter, err = common.CreateFilter(actionConfig.Filter, labels)
+
+	if err != nil {
+		return nil, err
 	}
 
 	log.Printf("Pipline %s action %d has %d bond targets", action.pipline.GetName(), index, len(action.validatorAddresses))
+	log.Printf("Stake limits: min %s, max %s, near max %s", limits.Min, limits.Max, limits.NearMax)
+	log.Printf("Bond strategy: %s", actionConfig.Strategy)
+	log.Printf("Fee policy: %s", fees)
 
 	totalStake := amount.Amount(0)
 
@@ -87,6 +133,8 @@ func CreateBondAction(pipline provider.PiplineProvider, index int, optionsConfig
 
 		if validatorInfo != nil {
 			availabilityScore = validatorInfo.AvailabilityScore
+		} else if _, ok := action.publicKeys[address]; !ok {
+			log.Printf("%s is not on chain yet and has no public key, it will be skipped until created", address)
 		}
 
 		log.Printf("%d - %s - stake: %s (score: %v)", i+1, address, amount.String(), availabilityScore)
@@ -98,10 +146,6 @@ func CreateBondAction(pipline provider.PiplineProvider, index int, optionsConfig
 	return action, nil
 }
 
-func (p *BondAction) GetTime() []string {
-	return p.time
-}
-
 func (p *BondAction) GetName() string {
 	return "bond"
 }
@@ -110,224 +154,276 @@ func (p *BondAction) GetValidatorAddresses() []string {
 	return p.validatorAddresses
 }
 
-const (
-	MIN_STAKE = amount.Amount(1000000000)
-	//KEEP_FOR_FEE = MIN_STAKE
-	MAX_STAKE = amount.Amount(1000000000000)
-	//MIN_FEE   = amount.Amount(10000000) // 0.01
+func (p *BondAction) GetFilter() *common.Filter {
+	return p.filter
+}
 
-	NEAR_MAX_STAKE = MAX_STAKE - MIN_STAKE
-)
+func (p *BondAction) getWeight(validatorAddress string) float64 {
+	if weight, ok := p.weights[validatorAddress]; ok {
+		return weight
+	}
 
-func (p *BondAction) Run() error {
+	return 1
+}
+
+func (p *BondAction) Run(runID string) error {
 	addresses, amounts, err := p.pipline.GetAllBalance()
 
 	if err != nil {
 		return fmt.Errorf("failed to get all balances: %w", err)
 	}
 
-	type stakeCacheInfo struct {
-		amount        amount.Amount
-		validatorInfo *pactus.ValidatorInfo
-	}
-
-	stakeCacheMap := make(map[string]*stakeCacheInfo)
-
-	broadcastCount := 0
+	accounts := make([]Account, 0, len(addresses))
 
 	for accountIndex, accountAddress := range addresses {
-		/*switch accountAddress {
-		case "tpc1z2xcq07fpf2vehnc9u8cgc28s2q4c7kfl8y63k7",
-			"tpc1zkxqqxvgkz4fm8gvefefex936k2t2909f6n0d83",
-			"tpc1zs6txk95fww68eaqlx3rsnjhs84y3lmyetml2wt",
-			"tpc1zytlvs44sxrhwd9l6jzqqcq85mf4ssdfj2a7dq0":
+		if !p.filter.AllowAccount(accountAddress) {
+			log.Printf("[account facts] - %s - excluded", accountAddress)
 			continue
-		}*/
+		}
+
+		log.Printf("[account facts] - %s - balance: %s", accountAddress, amounts[accountIndex])
 
-		balance := amounts[accountIndex]
+		accounts = append(accounts, Account{
+			Address: accountAddress,
+			Balance: amounts[accountIndex],
+		})
+	}
 
-		log.Printf("[account facts] - %s - balance: %s", accountAddress, balance)
+	validators := make([]Validator, 0, len(p.validatorAddresses))
+	exists := make(map[string]bool)
 
-		if balance <= (p.reserveFees + MIN_STAKE) {
-			// keep 1 PAC for fee and keep 1 PAC for minimum stake
+	for _, validatorAddress := range p.validatorAddresses {
+		if !p.filter.AllowValidator(validatorAddress) {
+			log.Printf("[validator facts] validator=%v excluded", validatorAddress)
 			continue
 		}
 
-		availableTx := balance - p.reserveFees
+		stake, validatorInfo, err := p.pipline.GetValidatorStake(validatorAddress)
 
-		wlt, password := p.pipline.GetAccountWallet(accountAddress)
+		if err != nil {
+			return err
+		}
 
-		if wlt == nil {
-			return fmt.Errorf("failed to get wallet for address: %s", accountAddress)
+		availabilityScore := 1.0
+
+		if validatorInfo != nil {
+			availabilityScore = validatorInfo.AvailabilityScore
 		}
 
-		validatorAddresses := make([]string, len(p.validatorAddresses))
+		log.Printf("[validator facts] validator=%v stake=%v wants=%v score=%v", validatorAddress, stake, p.limits.Max-stake, availabilityScore)
 
-		copy(validatorAddresses[:], p.validatorAddresses[:])
+		if _, ok := p.publicKeys[validatorAddress]; validatorInfo == nil && !ok {
+			log.Printf("[validator facts] validator=%v no public key to create it, skip", validatorAddress)
+			continue
+		}
 
-		for {
-			if len(validatorAddresses) == 0 {
-				break
-			}
+		if availabilityScore < p.minAvailability {
+			log.Printf("[validator facts] validator=%v score below %v, skip", validatorAddress, p.minAvailability)
+			continue
+		}
 
-			/*switch validatorAddresses[0] {
-			case "tpc1pphac0a0qta6h85y2t45vlj6r6lndyh5szk0et3",
-				"tpc1p9jj07hxw74r6eu33ep9uja522s5ml83hvh0tja",
-				"tpc1pcl7yd9vtqvnefzwl3q2g7r6f4eky66uuqltw5k",
-				"tpc1pjlgtzlk36my0qnzm9krf0jgf6jvs2uafnpqvkg":
-				validatorAddresses = validatorAddresses[1:]
-				continue
-			}*/
+		exists[validatorAddress] = validatorInfo != nil
 
-			stake := amount.Amount(0)
-			var validatorInfo *pactus.ValidatorInfo
+		validators = append(validators, Validator{
+			Address: validatorAddress,
+			Stake:   stake,
+			Weight:  p.getWeight(validatorAddress),
+			Score:   availabilityScore,
+		})
+	}
 
-			if stakeCache, ok := stakeCacheMap[validatorAddresses[0]]; ok {
-				stake = stakeCache.amount
-				validatorInfo = stakeCache.validatorInfo
-			} else {
-				stakeGet, validatorInfoGet, err := p.pipline.GetValidatorStake(validatorAddresses[0])
+	if p.sortByScore {
+		// fill the healthiest validators first
+		sort.SliceStable(validators, func(i, j int) bool {
+			return validators[i].Score > validators[j].Score
+		})
+	}
 
-				if err != nil {
-					return err
-				}
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_BOND)
 
-				stake = stakeGet
-				validatorInfo = validatorInfoGet
+	if err != nil {
+		return err
+	}
+
+	allocations := p.strategy.Allocate(accounts, validators, fee)
+
+	committee, err := p.committeeMembers()
+
+	if err != nil {
+		return err
+	}
+
+	tracker := common.CreateTxTracker(p.pipline, p.confirmTimeout)
+	bonded := make([]Allocation, 0, len(allocations))
+	deferred := make([]Allocation, 0)
+
+	for i, allocation := range allocations {
+		if committee[allocation.Validator] {
+			log.Printf("[validator bond] validator=%v in committee, defer bond=%v", allocation.Validator, allocation.Amount)
+			deferred = append(deferred, allocation)
+			continue
+		}
+
+		// create new validator without full stake, wait until it is
+		// created before bonding to it again
+		waitCreated := !exists[allocation.Validator] && hasAllocation(allocations[i+1:], allocation.Validator)
+
+		err := p.bond(runID, allocation, fee, tracker, waitCreated)
 
-				stakeCacheMap[validatorAddresses[0]] = &stakeCacheInfo{
-					amount:        stake,
-					validatorInfo: validatorInfo,
-				}
-			}
+		if err != nil {
+			return err
+		}
 
-			wants := MAX_STAKE - stake
+		exists[allocation.Validator] = true
+		bonded = append(bonded, allocation)
+	}
 
-			log.Printf("[validator facts] validator=%v stake=%v wants=%v", validatorAddresses[0], stake, wants)
+	if len(bonded) > 0 {
+		log.Printf("wait block confirm")
 
-			if wants < MIN_STAKE {
-				validatorAddresses = validatorAddresses[1:]
-				continue
-			}
+		err = tracker.Report()
 
-			// stakeAvailable := min(wants, amount)
-			stakeAvailable := wants
+		if err != nil {
+			return err
+		}
 
-			if stakeAvailable > availableTx {
-				stakeAvailable = availableTx
-			}
+		err = p.logStakes(bonded)
 
-			after := stakeAvailable + stake
+		if err != nil {
+			return err
+		}
+	}
 
-			if after != MAX_STAKE && after > NEAR_MAX_STAKE {
-				stakeAvailable = NEAR_MAX_STAKE - stake
-				after = stake + stakeAvailable
-			}
+	return p.deferBonds(runID, deferred)
+}
 
-			if stakeAvailable < MIN_STAKE {
-				continue
-			}
+// deferBonds leaves the bonds to validators in the committee to a later run of
+// the same run ID, the executor runs it again after the poll interval. The
+// allocations are computed again from the balances at that time. Bonds still
+// deferred at the committee deadline are given up.
+func (p *BondAction) deferBonds(runID string, deferred []Allocation) error {
+	if len(deferred) == 0 {
+		delete(p.deferredSince, runID)
+		return nil
+	}
 
-			/*fee, err := wlt.CalculateFee(stakeAvailable, payload.TypeBond)
+	now := p.pipline.GetClock().Now()
+	since, ok := p.deferredSince[runID]
 
-			if err != nil {
-				log.Printf("Failed to calculate fee: %v", err)
-			}
+	if !ok {
+		since = now
+		p.deferredSince[runID] = now
+	}
 
-			if fee < p.txFee {
-				fee = p.txFee
-			}*/
+	if now.Sub(since) >= p.committeeDeadline {
+		for _, allocation := range deferred {
+			log.Printf("[validator bond] validator=%v still in committee at deadline, give up bond=%v", allocation.Validator, allocation.Amount)
+		}
 
-			fee := p.txFee
+		delete(p.deferredSince, runID)
 
-			log.Printf("[validator bond] validator=%v bond=%v fee=%v after=%v", validatorAddresses[0], stakeAvailable, fee, after)
+		return nil
+	}
 
-			opts := []wallet.TxOption{
-				wallet.OptionFee(fee.String()),
-				//wallet.OptionLockTime(uint32(*lockTime)),
-				//wallet.OptionMemo(*memoOpt),
-			}
+	log.Printf("[validator bond] %d bonds deferred, check committee again in %s", len(deferred), committeePollInterval)
 
-			//addressInfo := wlt.AddressFromPath(validatorAddresses[0])
+	return &common.DeferredError{
+		Reason:     fmt.Sprintf("%d bonds to validators in committee deferred", len(deferred)),
+		RetryAfter: committeePollInterval,
+	}
+}
 
-			//wltAddr, _ := crypto.AddressFromString(wltAddrInfo.Address)
+func (p *BondAction) bond(runID string, allocation Allocation, fee amount.Amount, tracker *common.TxTracker, waitCreated bool) error {
+	wlt, password := p.pipline.GetAccountWallet(allocation.Account)
 
-			pub := ""
+	if wlt == nil {
+		return fmt.Errorf("failed to get wallet for address: %s", allocation.Account)
+	}
 
-			if info, ok := p.validatorAddressInfo[validatorAddresses[0]]; ok {
-				pub = info.PublicKey
-			} else {
-				return fmt.Errorf("failed to get public key for address: %s", validatorAddresses[0])
-			}
+	log.Printf("[validator bond] account=%v validator=%v bond=%v fee=%v after=%v", allocation.Account, allocation.Validator, allocation.Amount, fee, allocation.After)
 
-			trx, err := wlt.MakeBondTx(accountAddress, validatorAddresses[0], pub, stakeAvailable, opts...)
+	opts, err := p.txTemplate.Options(runID, allocation.Validator)
 
-			if err != nil {
-				return fmt.Errorf("failed to make bond transaction: %w", err)
-			}
+	if err != nil {
+		return err
+	}
 
-			err = wlt.SignTransaction(password, trx)
+	opts = append(opts, wallet.OptionFee(fee.String()))
 
-			if err != nil {
-				return fmt.Errorf("failed to sign transaction: %w", err)
-			}
+	// only required when the bond creates the validator
+	pub := p.publicKeys[allocation.Validator]
 
-			bs, _ := trx.Bytes()
+	trx, err := wlt.MakeBondTx(allocation.Account, allocation.Validator, pub, allocation.Amount, opts...)
 
-			log.Printf("Signed transaction data: %x", bs)
+	if err != nil {
+		return fmt.Errorf("failed to make bond transaction: %w", err)
+	}
 
-			res, err := wlt.BroadcastTransaction(trx)
+	id, err := common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
 
-			if err != nil {
-				return fmt.Errorf("failed to broadcast transaction: %w", err)
-			}
+	if err != nil {
+		return err
+	}
 
-			broadcastCount++
+	tracker.Add(id)
 
-			log.Printf("Transaction hash: %s", res)
+	if !waitCreated {
+		return nil
+	}
 
-			if validatorInfo == nil && after != MAX_STAKE {
-				// last account and last validator, use end of run action wait
-				if accountIndex == len(addresses)-1 && len(validatorAddresses) == 1 {
-					break
-				}
+	log.Printf("[validator bond] validator=%v wait block confirm", allocation.Validator)
 
-				// create new validator without full stake, wait for next block
-				log.Printf("[validator bond] validator=%v wait block confirm", validatorAddresses[0])
-				// ensure the transaction is confirmed
-				time.Sleep(11 * time.Second)
+	result := tracker.Wait(id)
 
-				stakeGet, validatorInfoGet, err := p.pipline.GetValidatorStake(validatorAddresses[0])
+	if result.Status != common.TxConfirmed {
+		// log the state of the other transactions of the run, the error
+		// tells whether the run can be retried
+		err := tracker.Report()
+		return fmt.Errorf("failed to create validator %s: transaction %s: %w", allocation.Validator, result.Status, err)
+	}
 
-				if err != nil {
-					return err
-				}
+	stake, _, err := p.pipline.GetValidatorStake(allocation.Validator)
 
-				stakeCacheMap[validatorAddresses[0]].amount = stakeGet
-				stakeCacheMap[validatorAddresses[0]].validatorInfo = validatorInfoGet
-			} else {
-				stakeCacheMap[validatorAddresses[0]].amount = after
-			}
+	if err != nil {
+		return err
+	}
 
-			validatorAddresses = validatorAddresses[1:]
+	log.Printf("[validator bond] validator=%v created stake=%v", allocation.Validator, stake)
 
-			balance -= stakeAvailable + fee
-			availableTx = balance - p.reserveFees
+	return nil
+}
 
-			log.Printf("[account update] - %s - balance: %s", accountAddress, balance)
+// logStakes re-reads the stake of the bonded validators once all the bonds are included.
+func (p *BondAction) logStakes(allocations []Allocation) error {
+	expected := make(map[string]amount.Amount)
+	order := make([]string, 0)
 
-			if balance <= (p.reserveFees + MIN_STAKE) {
-				// keep 1 PAC for fee and keep 1 PAC for minimum stake
-				break // to next account
-			}
+	for _, allocation := range allocations {
+		if _, ok := expected[allocation.Validator]; !ok {
+			order = append(order, allocation.Validator)
 		}
+		expected[allocation.Validator] = allocation.After
 	}
 
-	if broadcastCount > 0 {
-		log.Printf("wait block confirm")
-		// ensure the transaction is confirmed
-		time.Sleep(11 * time.Second)
+	for _, validatorAddress := range order {
+		stake, _, err := p.pipline.GetValidatorStake(validatorAddress)
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[validator facts] validator=%v stake=%v expected=%v", validatorAddress, stake, expected[validatorAddress])
 	}
 
 	return nil
 }
+
+func hasAllocation(allocations []Allocation, validatorAddress string) bool {
+	for _, allocation := range allocations {
+		if allocation.Validator == validatorAddress {
+			return true
+		}
+	}
+
+	return false
+}
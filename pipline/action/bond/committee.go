@@ -0,0 +1,51 @@
+package bond
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCommitteeDeadline = time.Hour
+	committeePollInterval    = 30 * time.Second
+)
+
+// A validator does not take part in the committee for a while after a bond, so
+// bonding to a validator that is in the committee costs it its block rewards.
+// With defer_in_committee these bonds are left to later runs of the same run
+// ID, until the validator leaves the committee or the committee deadline.
+
+func parseCommitteeDeadline(deadline string) (time.Duration, error) {
+	if deadline == "" {
+		return defaultCommitteeDeadline, nil
+	}
+
+	d, err := time.ParseDuration(deadline)
+	if err != nil {
+		return 0, fmt.Errorf("invalid committee deadline %q: %w", deadline, err)
+	}
+
+	return d, nil
+}
+
+// committeeMembers returns the addresses of the validators in the committee,
+// or an empty set if bonds are not deferred.
+func (p *BondAction) committeeMembers() (map[string]bool, error) {
+	members := make(map[string]bool)
+
+	if !p.deferInCommittee {
+		return members, nil
+	}
+
+	info, err := p.pipline.GetCommitteeInfo()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get committee info: %w", err)
+	}
+
+	for _, validator := range info.Validators {
+		members[validator.Address] = true
+	}
+
+	return members, nil
+}
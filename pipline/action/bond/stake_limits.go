@@ -0,0 +1,72 @@
+package bond
+
+import (
+	"fmt"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/pactus-project/pactus/genesis"
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+type StakeLimits struct {
+	Min amount.Amount
+	Max amount.Amount
+	// NearMax is the highest stake below Max a validator may be bonded to,
+	// so a later bond of at least Min can still fill it up to Max.
+	NearMax amount.Amount
+}
+
+// CreateStakeLimits reads min_stake, max_stake and near_max_gap from the action config,
+// falling back to the consensus params, and checks they are consistent with each other.
+func CreateStakeLimits(params *genesis.GenesisParams, actionConfig *config.Action) (*StakeLimits, error) {
+	limits := &StakeLimits{
+		Min: params.MinimumStake,
+		Max: params.MaximumStake,
+	}
+
+	if actionConfig.MinStake != 0 {
+		minStake, err := amount.NewAmount(actionConfig.MinStake)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create min stake: %w", err)
+		}
+		limits.Min = minStake
+	}
+
+	if actionConfig.MaxStake != 0 {
+		maxStake, err := amount.NewAmount(actionConfig.MaxStake)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create max stake: %w", err)
+		}
+		limits.Max = maxStake
+	}
+
+	gap := limits.Min
+
+	if actionConfig.NearMaxGap != 0 {
+		nearMaxGap, err := amount.NewAmount(actionConfig.NearMaxGap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create near max gap: %w", err)
+		}
+		gap = nearMaxGap
+	}
+
+	if limits.Min < params.MinimumStake {
+		return nil, fmt.Errorf("min_stake %s is below the consensus minimum stake %s", limits.Min, params.MinimumStake)
+	}
+
+	if limits.Max > params.MaximumStake {
+		return nil, fmt.Errorf("max_stake %s is above the consensus maximum stake %s", limits.Max, params.MaximumStake)
+	}
+
+	if limits.Max <= limits.Min {
+		return nil, fmt.Errorf("max_stake %s must be greater than min_stake %s", limits.Max, limits.Min)
+	}
+
+	if gap < limits.Min || gap >= limits.Max-limits.Min {
+		return nil, fmt.Errorf("near_max_gap %s must be at least min_stake %s and below max_stake - min_stake", gap, limits.Min)
+	}
+
+	limits.NearMax = limits.Max - gap
+
+	return limits, nil
+}
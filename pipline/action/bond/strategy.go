@@ -0,0 +1,201 @@
+package bond
+
+import (
+	"fmt"
+
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+type Account struct {
+	Address string
+	Balance amount.Amount
+}
+
+type Validator struct {
+	Address string
+	Stake   amount.Amount
+	Weight  float64
+	Score   float64
+}
+
+type Allocation struct {
+	Account   string
+	Validator string
+	Amount    amount.Amount
+	// After is the expected stake of the validator once the bond is committed
+	After amount.Amount
+}
+
+// Strategy decides how the account balances are bonded to the validators.
+// It only plans the bonds, signing and broadcasting is done by the bond action.
+type Strategy interface {
+	Allocate(accounts []Account, validators []Validator, fee amount.Amount) []Allocation
+}
+
+type allocator struct {
+	limits      *StakeLimits
+	reserveFees amount.Amount
+}
+
+func CreateStrategy(name string, limits *StakeLimits, reserveFees amount.Amount) (Strategy, error) {
+	alloc := allocator{
+		limits:      limits,
+		reserveFees: reserveFees,
+	}
+
+	switch name {
+	case "", "fill-first":
+		return &fillFirstStrategy{alloc}, nil
+	case "lowest-stake-first":
+		return &lowestStakeFirstStrategy{alloc}, nil
+	case "spread-even":
+		return &spreadEvenStrategy{alloc}, nil
+	case "weighted":
+		return &weightedStrategy{alloc}, nil
+	default:
+		return nil, fmt.Errorf("unknown bond strategy: %s", name)
+	}
+}
+
+// distribute bonds the accounts, in order, to the validators, in order, until each
+// validator got its need. A bond never leaves a validator between NearMax and Max,
+// and is never below Min. The fee of each bond is taken from the account balance.
+func (a *allocator) distribute(accounts []Account, validators []Validator, needs []amount.Amount, fee amount.Amount) []Allocation {
+	allocations := make([]Allocation, 0)
+	reserve := common.Reserve(a.reserveFees, fee)
+
+	stakes := make([]amount.Amount, len(validators))
+
+	for i, v := range validators {
+		stakes[i] = v.Stake
+	}
+
+	for _, account := range accounts {
+		balance := account.Balance
+
+		if balance <= (reserve + a.limits.Min) {
+			// keep reserve for fee and keep minimum stake
+			continue
+		}
+
+		for i, v := range validators {
+			want := needs[i]
+
+			if want > a.limits.Max-stakes[i] {
+				want = a.limits.Max - stakes[i]
+			}
+
+			if want < a.limits.Min {
+				continue
+			}
+
+			stakeAvailable := want
+
+			if stakeAvailable > balance-reserve {
+				stakeAvailable = balance - reserve
+			}
+
+			after := stakes[i] + stakeAvailable
+
+			if after != a.limits.Max && after > a.limits.NearMax {
+				stakeAvailable = a.limits.NearMax - stakes[i]
+				after = stakes[i] + stakeAvailable
+			}
+
+			if stakeAvailable < a.limits.Min {
+				continue
+			}
+
+			allocations = append(allocations, Allocation{
+				Account:   account.Address,
+				Validator: v.Address,
+				Amount:    stakeAvailable,
+				After:     after,
+			})
+
+			stakes[i] = after
+			needs[i] -= stakeAvailable
+			balance -= stakeAvailable + fee
+
+			if balance <= (reserve + a.limits.Min) {
+				break // to next account
+			}
+		}
+	}
+
+	return allocations
+}
+
+func (a *allocator) totalAvailable(accounts []Account, fee amount.Amount) amount.Amount {
+	total := amount.Amount(0)
+	reserve := common.Reserve(a.reserveFees, fee)
+
+	for _, account := range accounts {
+		if account.Balance > reserve {
+			total += account.Balance - reserve
+		}
+	}
+
+	return total
+}
+
+// waterFill returns how much each validator needs so the stakes become proportional
+// to the weights, spending at most the available amount and never above Max.
+func (a *allocator) waterFill(validators []Validator, available amount.Amount) []amount.Amount {
+	needAt := func(level float64, v Validator) amount.Amount {
+		target := amount.Amount(level * v.Weight)
+
+		if target > a.limits.Max {
+			target = a.limits.Max
+		}
+
+		if target <= v.Stake {
+			return 0
+		}
+
+		return target - v.Stake
+	}
+
+	totalAt := func(level float64) amount.Amount {
+		total := amount.Amount(0)
+
+		for _, v := range validators {
+			total += needAt(level, v)
+		}
+
+		return total
+	}
+
+	minWeight := 0.0
+
+	for _, v := range validators {
+		if v.Weight > 0 && (minWeight == 0 || v.Weight < minWeight) {
+			minWeight = v.Weight
+		}
+	}
+
+	needs := make([]amount.Amount, len(validators))
+
+	if minWeight == 0 {
+		return needs
+	}
+
+	low, high := 0.0, float64(a.limits.Max)/minWeight
+
+	for range 100 {
+		mid := (low + high) / 2
+
+		if totalAt(mid) <= available {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	for i, v := range validators {
+		needs[i] = needAt(low, v)
+	}
+
+	return needs
+}
@@ -0,0 +1,18 @@
+package bond
+
+import "github.com/pactus-project/pactus/types/amount"
+
+// fillFirstStrategy fills the first validator up to the max stake, then the next one.
+type fillFirstStrategy struct {
+	allocator
+}
+
+func (s *fillFirstStrategy) Allocate(accounts []Account, validators []Validator, fee amount.Amount) []Allocation {
+	needs := make([]amount.Amount, len(validators))
+
+	for i, v := range validators {
+		needs[i] = s.limits.Max - v.Stake
+	}
+
+	return s.distribute(accounts, validators, needs, fee)
+}
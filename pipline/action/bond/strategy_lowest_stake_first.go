@@ -0,0 +1,31 @@
+package bond
+
+import (
+	"sort"
+
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+// lowestStakeFirstStrategy fills the validators up to the max stake,
+// starting with the validator that has the lowest stake.
+type lowestStakeFirstStrategy struct {
+	allocator
+}
+
+func (s *lowestStakeFirstStrategy) Allocate(accounts []Account, validators []Validator, fee amount.Amount) []Allocation {
+	sorted := make([]Validator, len(validators))
+
+	copy(sorted, validators)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Stake < sorted[j].Stake
+	})
+
+	needs := make([]amount.Amount, len(sorted))
+
+	for i, v := range sorted {
+		needs[i] = s.limits.Max - v.Stake
+	}
+
+	return s.distribute(accounts, sorted, needs, fee)
+}
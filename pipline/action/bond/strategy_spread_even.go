@@ -0,0 +1,22 @@
+package bond
+
+import "github.com/pactus-project/pactus/types/amount"
+
+// spreadEvenStrategy raises the lowest stakes first so all validators end up
+// with the same stake as far as the balance allows.
+type spreadEvenStrategy struct {
+	allocator
+}
+
+func (s *spreadEvenStrategy) Allocate(accounts []Account, validators []Validator, fee amount.Amount) []Allocation {
+	even := make([]Validator, len(validators))
+
+	for i, v := range validators {
+		even[i] = v
+		even[i].Weight = 1
+	}
+
+	needs := s.waterFill(even, s.totalAvailable(accounts, fee))
+
+	return s.distribute(accounts, even, needs, fee)
+}
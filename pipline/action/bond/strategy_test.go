@@ -0,0 +1,231 @@
+package bond
+
+import (
+	"testing"
+
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+func pac(f float64) amount.Amount {
+	a, _ := amount.NewAmount(f)
+
+	return a
+}
+
+func testLimits() *StakeLimits {
+	return &StakeLimits{
+		Min:     pac(1),
+		Max:     pac(1000),
+		NearMax: pac(999),
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		accounts   []Account
+		validators []Validator
+		// fee is 0.01 if not set
+		fee  amount.Amount
+		want []Allocation
+	}{
+		{
+			name:       "fill-first fills the first validator",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(501)}},
+			validators: []Validator{{Address: "val1"}, {Address: "val2"}},
+			want:       []Allocation{{"acc1", "val1", pac(500), pac(500)}},
+		},
+		{
+			name:       "fill-first moves to the next validator at max stake",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(301)}, {"acc2", pac(801)}},
+			validators: []Validator{{Address: "val1"}, {Address: "val2"}},
+			want: []Allocation{
+				{"acc1", "val1", pac(300), pac(300)},
+				{"acc2", "val1", pac(700), pac(1000)},
+				// the fee of the first bond is taken from the balance
+				{"acc2", "val2", pac(99.99), pac(99.99)},
+			},
+		},
+		{
+			name:       "fill-first skips a validator at max stake",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(101)}},
+			validators: []Validator{{Address: "val1", Stake: pac(1000)}, {Address: "val2"}},
+			want:       []Allocation{{"acc1", "val2", pac(100), pac(100)}},
+		},
+		{
+			name:       "fill-first stops at near max",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(500.5)}},
+			validators: []Validator{{Address: "val1", Stake: pac(500)}},
+			want:       []Allocation{{"acc1", "val1", pac(499), pac(999)}},
+		},
+		{
+			name:       "fill-first keeps the reserve and the min stake",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(2)}},
+			validators: []Validator{{Address: "val1"}},
+			want:       []Allocation{},
+		},
+		{
+			name:       "fill-first does not bond below min stake",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(101)}},
+			validators: []Validator{{Address: "val1", Stake: pac(999.5)}, {Address: "val2"}},
+			want:       []Allocation{{"acc1", "val2", pac(100), pac(100)}},
+		},
+		{
+			name:       "fill-first keeps a fee above the reserve",
+			strategy:   "fill-first",
+			accounts:   []Account{{"acc1", pac(501)}},
+			validators: []Validator{{Address: "val1"}},
+			fee:        pac(2),
+			want:       []Allocation{{"acc1", "val1", pac(499), pac(499)}},
+		},
+		{
+			name:       "lowest-stake-first starts with the lowest stake",
+			strategy:   "lowest-stake-first",
+			accounts:   []Account{{"acc1", pac(401)}},
+			validators: []Validator{{Address: "val1", Stake: pac(300)}, {Address: "val2", Stake: pac(100)}},
+			want:       []Allocation{{"acc1", "val2", pac(400), pac(500)}},
+		},
+		{
+			name:     "lowest-stake-first moves to the next lowest stake",
+			strategy: "lowest-stake-first",
+			accounts: []Account{{"acc1", pac(1001)}},
+			validators: []Validator{
+				{Address: "val1", Stake: pac(300)},
+				{Address: "val2", Stake: pac(1000)},
+				{Address: "val3", Stake: pac(200)},
+			},
+			want: []Allocation{
+				{"acc1", "val3", pac(800), pac(1000)},
+				{"acc1", "val1", pac(199.99), pac(499.99)},
+			},
+		},
+		{
+			name:       "spread-even raises the lowest stake first",
+			strategy:   "spread-even",
+			accounts:   []Account{{"acc1", pac(401)}},
+			validators: []Validator{{Address: "val1"}, {Address: "val2", Stake: pac(200)}},
+			want: []Allocation{
+				{"acc1", "val1", pac(300), pac(300)},
+				{"acc1", "val2", pac(99.99), pac(299.99)},
+			},
+		},
+		{
+			name:       "spread-even ignores the weights",
+			strategy:   "spread-even",
+			accounts:   []Account{{"acc1", pac(201)}},
+			validators: []Validator{{Address: "val1", Weight: 1}, {Address: "val2", Weight: 3}},
+			want: []Allocation{
+				{"acc1", "val1", pac(100), pac(100)},
+				{"acc1", "val2", pac(99.99), pac(99.99)},
+			},
+		},
+		{
+			name:       "spread-even caps at max stake",
+			strategy:   "spread-even",
+			accounts:   []Account{{"acc1", pac(3001)}},
+			validators: []Validator{{Address: "val1", Stake: pac(900)}, {Address: "val2"}},
+			want: []Allocation{
+				{"acc1", "val1", pac(100), pac(1000)},
+				{"acc1", "val2", pac(1000), pac(1000)},
+			},
+		},
+		{
+			name:       "weighted follows the weights",
+			strategy:   "weighted",
+			accounts:   []Account{{"acc1", pac(401)}},
+			validators: []Validator{{Address: "val1", Weight: 1}, {Address: "val2", Weight: 3}},
+			want: []Allocation{
+				{"acc1", "val1", pac(100), pac(100)},
+				{"acc1", "val2", pac(299.99), pac(299.99)},
+			},
+		},
+		{
+			name:       "weighted gives the rest to the others at max stake",
+			strategy:   "weighted",
+			accounts:   []Account{{"acc1", pac(2001)}},
+			validators: []Validator{{Address: "val1", Weight: 1}, {Address: "val2", Weight: 3}},
+			want: []Allocation{
+				{"acc1", "val1", pac(1000), pac(1000)},
+				// 999.99 would be between near max and max
+				{"acc1", "val2", pac(999), pac(999)},
+			},
+		},
+		{
+			name:       "weighted keeps a fee above the reserve",
+			strategy:   "weighted",
+			accounts:   []Account{{"acc1", pac(402)}},
+			validators: []Validator{{Address: "val1", Weight: 1}, {Address: "val2", Weight: 1}},
+			fee:        pac(2),
+			want: []Allocation{
+				{"acc1", "val1", pac(200), pac(200)},
+				{"acc1", "val2", pac(198), pac(198)},
+			},
+		},
+		{
+			name:       "weighted skips zero weights",
+			strategy:   "weighted",
+			accounts:   []Account{{"acc1", pac(401)}},
+			validators: []Validator{{Address: "val1", Weight: 0}, {Address: "val2", Weight: 1}},
+			want:       []Allocation{{"acc1", "val2", pac(400), pac(400)}},
+		},
+		{
+			name:       "weighted with no weight bonds nothing",
+			strategy:   "weighted",
+			accounts:   []Account{{"acc1", pac(401)}},
+			validators: []Validator{{Address: "val1"}, {Address: "val2"}},
+			want:       []Allocation{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := CreateStrategy(tt.strategy, testLimits(), pac(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fee := tt.fee
+
+			if fee == 0 {
+				fee = pac(0.01)
+			}
+
+			got := strategy.Allocate(tt.accounts, tt.validators, fee)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d allocations %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+
+			for i := range got {
+				if !sameAllocation(got[i], tt.want[i]) {
+					t.Errorf("allocation %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// sameAllocation allows a few NanoPAC of difference, the water fill level is
+// found by bisection on floats.
+func sameAllocation(got, want Allocation) bool {
+	near := func(a, b amount.Amount) bool {
+		return a-b <= 10 && b-a <= 10
+	}
+
+	return got.Account == want.Account && got.Validator == want.Validator &&
+		near(got.Amount, want.Amount) && near(got.After, want.After)
+}
+
+func TestCreateStrategyUnknown(t *testing.T) {
+	_, err := CreateStrategy("biggest-first", testLimits(), pac(1))
+	if err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+}
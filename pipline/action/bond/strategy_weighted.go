@@ -0,0 +1,15 @@
+package bond
+
+import "github.com/pactus-project/pactus/types/amount"
+
+// weightedStrategy makes the stakes proportional to the per-target weights
+// as far as the balance allows.
+type weightedStrategy struct {
+	allocator
+}
+
+func (s *weightedStrategy) Allocate(accounts []Account, validators []Validator, fee amount.Amount) []Allocation {
+	needs := s.waterFill(validators, s.totalAvailable(accounts, fee))
+
+	return s.distribute(accounts, validators, needs, fee)
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeferredError is returned by an action that did what it could of its run and
+// left the rest for later. It is not retried as a failure, the executor runs
+// the action again with the same run ID after RetryAfter, without holding the
+// pipline in the meantime.
+type DeferredError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("%s, run again in %s", e.Reason, e.RetryAfter)
+}
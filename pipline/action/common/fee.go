@@ -0,0 +1,108 @@
+package common
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/types/amount"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+// FeePolicy decides the fee of the transactions of an action. The fixed policy
+// always pays options.tx_fee, the estimate policy asks the node for the fee,
+// raised to min_fee and rejected above max_fee.
+type FeePolicy struct {
+	pipline provider.PiplineProvider
+	policy  string
+	fixed   amount.Amount
+	minFee  amount.Amount
+	maxFee  amount.Amount
+}
+
+func CreateFeePolicy(pipline provider.PiplineProvider, optionsConfig *config.Options, actionConfig *config.Action) (*FeePolicy, error) {
+	fixed, err := amount.NewAmount(optionsConfig.TxFee)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tx fee: %w", err)
+	}
+
+	minFee, err := amount.NewAmount(actionConfig.MinFee)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create min fee: %w", err)
+	}
+
+	maxFee, err := amount.NewAmount(actionConfig.MaxFee)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create max fee: %w", err)
+	}
+
+	policy := actionConfig.FeePolicy
+
+	switch policy {
+	case "":
+		policy = "fixed"
+	case "fixed", "estimate":
+	default:
+		return nil, fmt.Errorf("unknown fee policy: %s", policy)
+	}
+
+	if maxFee != 0 && minFee > maxFee {
+		return nil, fmt.Errorf("min_fee %s must not be greater than max_fee %s", minFee, maxFee)
+	}
+
+	return &FeePolicy{
+		pipline: pipline,
+		policy:  policy,
+		fixed:   fixed,
+		minFee:  minFee,
+		maxFee:  maxFee,
+	}, nil
+}
+
+func (f *FeePolicy) String() string {
+	if f.policy == "fixed" {
+		return fmt.Sprintf("fixed %s", f.fixed)
+	}
+
+	return fmt.Sprintf("estimate (min %s, max %s)", f.minFee, f.maxFee)
+}
+
+// Reserve returns what has to stay in an account that sends a transaction. The
+// fee is paid from the reserved fees, so a fee above reserve_fees is kept instead.
+func Reserve(reserveFees, fee amount.Amount) amount.Amount {
+	if fee > reserveFees {
+		return fee
+	}
+
+	return reserveFees
+}
+
+// Fee returns the fee of a transaction with the given payload type. An error is
+// returned if the estimated fee is above max_fee, so the run stops before signing.
+func (f *FeePolicy) Fee(payloadType pactus.PayloadType) (amount.Amount, error) {
+	if f.policy == "fixed" {
+		return f.fixed, nil
+	}
+
+	fee, err := f.pipline.CalculateFee(payloadType)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if fee < f.minFee {
+		fee = f.minFee
+	}
+
+	if f.maxFee != 0 && fee > f.maxFee {
+		return 0, fmt.Errorf("estimated fee %s exceeds max_fee %s", fee, f.maxFee)
+	}
+
+	log.Printf("[fee] payload=%v fee=%v", payloadType, fee)
+
+	return fee, nil
+}
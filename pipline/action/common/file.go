@@ -0,0 +1,49 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the file with the data. The data is written to a
+// temporary file in the same directory and renamed over the file, so a crash
+// leaves either the old or the new content, never a truncated file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	// removing the renamed file fails, which is fine
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	err = os.Chmod(tmp.Name(), perm)
+
+	if err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+
+	if err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/pactus-project/pactus/crypto"
+)
+
+// Filter decides which accounts and validators an action may use.
+// Entries of the config lists are addresses or wallet labels.
+type Filter struct {
+	excludeAccounts   map[string]bool
+	excludeValidators map[string]bool
+	// an empty include set does not restrict that kind of address
+	includeAccounts   map[string]bool
+	includeValidators map[string]bool
+}
+
+// CreateFilter resolves the labels of the filter config to addresses. An entry
+// that is neither an address nor a known label is an error, a mistyped label
+// in include_only would otherwise allow everything.
+func CreateFilter(filterConfig config.Filter, labels map[string][]string) (*Filter, error) {
+	filter := &Filter{
+		excludeAccounts:   make(map[string]bool),
+		excludeValidators: make(map[string]bool),
+		includeAccounts:   make(map[string]bool),
+		includeValidators: make(map[string]bool),
+	}
+
+	resolve := func(entry string) ([]string, error) {
+		if _, err := crypto.AddressFromString(entry); err == nil {
+			return []string{entry}, nil
+		}
+
+		addresses, ok := labels[entry]
+
+		if !ok {
+			return nil, fmt.Errorf("filter entry %s is neither an address nor a known wallet label", entry)
+		}
+
+		return addresses, nil
+	}
+
+	for _, entry := range filterConfig.ExcludeAccounts {
+		addresses, err := resolve(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, address := range addresses {
+			filter.excludeAccounts[address] = true
+		}
+	}
+
+	for _, entry := range filterConfig.ExcludeValidators {
+		addresses, err := resolve(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, address := range addresses {
+			filter.excludeValidators[address] = true
+		}
+	}
+
+	for _, entry := range filterConfig.IncludeOnly {
+		addresses, err := resolve(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, address := range addresses {
+			addr, err := crypto.AddressFromString(address)
+
+			if err != nil {
+				continue
+			}
+
+			if addr.IsValidatorAddress() {
+				filter.includeValidators[address] = true
+			} else {
+				filter.includeAccounts[address] = true
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func (f *Filter) AllowAccount(address string) bool {
+	if f.excludeAccounts[address] {
+		return false
+	}
+
+	return len(f.includeAccounts) == 0 || f.includeAccounts[address]
+}
+
+func (f *Filter) AllowValidator(address string) bool {
+	if f.excludeValidators[address] {
+		return false
+	}
+
+	return len(f.includeValidators) == 0 || f.includeValidators[address]
+}
+
+// AddLabels adds the address labels of the targets to a label map.
+func AddLabels(labels map[string][]string, targets *Targets) {
+	for address, label := range targets.Labels {
+		labels[label] = append(labels[label], address)
+	}
+}
@@ -0,0 +1,340 @@
+package common
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/crypto"
+	"github.com/pactus-project/pactus/crypto/bls"
+	"github.com/pactus-project/pactus/wallet"
+	"gopkg.in/yaml.v3"
+)
+
+type Targets struct {
+	Addresses  []string
+	PublicKeys map[string]string
+	Labels     map[string]string
+	// Weights are read from csv target lists, validators not listed have no weight
+	Weights map[string]float64
+}
+
+// LoadTargets resolves the target list of an action. Each entry is a validator
+// address (with an optional public key), a path to a wallet file whose validator
+// addresses are used, or a path to a csv or yaml target list file.
+// The targets file, if set, is loaded after the targets.
+func LoadTargets(targets []config.Target, targetsFile string) (*Targets, error) {
+	result := &Targets{
+		Addresses:  make([]string, 0),
+		PublicKeys: make(map[string]string),
+		Labels:     make(map[string]string),
+		Weights:    make(map[string]float64),
+	}
+
+	processedAddresses := map[string]bool{}
+
+	add := func(address, publicKey, label string) error {
+		addr, err := crypto.AddressFromString(address)
+
+		if err != nil || !addr.IsValidatorAddress() {
+			return fmt.Errorf("target is not a validator address: %s", address)
+		}
+
+		if _, ok := processedAddresses[address]; ok {
+			log.Printf("ignore duplicate target address: %s", address)
+			return nil
+		}
+
+		processedAddresses[address] = true
+		result.Addresses = append(result.Addresses, address)
+
+		if publicKey != "" {
+			if err := CheckPublicKey(address, publicKey); err != nil {
+				return err
+			}
+
+			result.PublicKeys[address] = publicKey
+		}
+
+		if label != "" {
+			result.Labels[address] = label
+		}
+
+		return nil
+	}
+
+	if targetsFile != "" {
+		targets = append(append([]config.Target{}, targets...), config.Target{Path: targetsFile})
+	}
+
+	for _, target := range targets {
+		var err error
+
+		switch {
+		case target.Address != "":
+			err = add(target.Address, target.PublicKey, "")
+
+		case isAddress(target.Path):
+			err = add(target.Path, "", "")
+
+		case strings.HasSuffix(target.Path, ".csv"):
+			err = loadTargetsCsv(target.Path, add, result.Weights)
+
+		case strings.HasSuffix(target.Path, ".yml"), strings.HasSuffix(target.Path, ".yaml"):
+			err = loadTargetsYaml(target.Path, add)
+
+		default:
+			var wlt *wallet.Wallet
+
+			wlt, err = wallet.Open(context.Background(), target.Path)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to open target wallet %s: %w", target.Path, err)
+			}
+
+			for _, address := range wlt.ListAddresses(wallet.OnlyValidatorAddresses()) {
+				if err = add(address.Address, address.PublicKey, address.Label); err != nil {
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// CheckPublicKey checks that a public key is a valid BLS key of the validator
+// address, so a wrong key fails when the targets are loaded and not at broadcast.
+func CheckPublicKey(address, publicKey string) error {
+	addr, err := crypto.AddressFromString(address)
+
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", address, err)
+	}
+
+	pub, err := bls.PublicKeyFromString(publicKey)
+
+	if err != nil {
+		return fmt.Errorf("invalid public key of %s: %w", address, err)
+	}
+
+	if pub.ValidatorAddress() != addr {
+		return fmt.Errorf("public key of %s belongs to validator %s", address, pub.ValidatorAddress())
+	}
+
+	return nil
+}
+
+func isAddress(s string) bool {
+	_, err := crypto.AddressFromString(s)
+
+	return err == nil
+}
+
+type TargetRecord struct {
+	Address   string
+	PublicKey string
+	Label     string
+	Weight    float64
+}
+
+// ReadTargetsCsv reads a target list with a header line. The address column is
+// required, the public_key, label and weight columns are optional, so the file
+// written by the csv command can be read back.
+func ReadTargetsCsv(filename string) ([]TargetRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open target list %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target list %s: %w", filename, err)
+	}
+
+	result := make([]TargetRecord, 0)
+
+	if len(records) == 0 {
+		return result, nil
+	}
+
+	columns := make(map[string]int)
+
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["address"]; !ok {
+		return nil, fmt.Errorf("target list %s has no address column", filename)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	for line, record := range records[1:] {
+		targetRecord := TargetRecord{
+			Address:   field(record, "address"),
+			PublicKey: field(record, "public_key"),
+			Label:     field(record, "label"),
+		}
+
+		if targetRecord.Address == "" {
+			continue
+		}
+
+		if weight := field(record, "weight"); weight != "" {
+			targetRecord.Weight, err = strconv.ParseFloat(weight, 64)
+
+			if err != nil || targetRecord.Weight < 0 {
+				return nil, fmt.Errorf("invalid weight %s at line %d of %s", weight, line+2, filename)
+			}
+		}
+
+		result = append(result, targetRecord)
+	}
+
+	return result, nil
+}
+
+func WriteTargetsCsv(filename string, records []TargetRecord) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create csv file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	err = writer.Write([]string{"address", "public_key", "label", "weight"})
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for _, record := range records {
+		weight := ""
+
+		if record.Weight != 0 {
+			weight = strconv.FormatFloat(record.Weight, 'f', -1, 64)
+		}
+
+		err = writer.Write([]string{record.Address, record.PublicKey, record.Label, weight})
+		if err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func loadTargetsCsv(filename string, add func(address, publicKey, label string) error, weights map[string]float64) error {
+	records, err := ReadTargetsCsv(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err = add(record.Address, record.PublicKey, record.Label)
+
+		if err != nil {
+			return err
+		}
+
+		if record.Weight != 0 {
+			weights[record.Address] = record.Weight
+		}
+	}
+
+	return nil
+}
+
+// loadTargetsYaml reads a target list with the same entries as the targets of an action.
+func loadTargetsYaml(filename string, add func(address, publicKey, label string) error) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open target list %s: %w", filename, err)
+	}
+
+	var targets []config.Target
+
+	err = yaml.Unmarshal(data, &targets)
+	if err != nil {
+		return fmt.Errorf("failed to read target list %s: %w", filename, err)
+	}
+
+	for _, target := range targets {
+		address := target.Address
+
+		if address == "" {
+			address = target.Path
+		}
+
+		err = add(address, target.PublicKey, "")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ValidatorWallets struct {
+	pipline   provider.PiplineProvider
+	wallets   map[string]*wallet.Wallet
+	passwords map[string]string
+}
+
+// OpenValidatorWallets opens the wallets that hold validator keys, so the
+// action can sign transactions on behalf of the validators (unbond, withdraw).
+func OpenValidatorWallets(pipline provider.PiplineProvider, wallets []config.Wallet) (*ValidatorWallets, error) {
+	result := &ValidatorWallets{
+		pipline:   pipline,
+		wallets:   make(map[string]*wallet.Wallet),
+		passwords: make(map[string]string),
+	}
+
+	for _, validatorWallet := range wallets {
+		wlt, err := wallet.Open(context.Background(), validatorWallet.Path)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to open validator wallet %s: %w", validatorWallet.Path, err)
+		}
+
+		for _, address := range wlt.ListAddresses(wallet.OnlyValidatorAddresses()) {
+			result.wallets[address.Address] = wlt
+			result.passwords[address.Address] = validatorWallet.Password
+		}
+	}
+
+	return result, nil
+}
+
+// Get returns the wallet holding the key of a validator, the validator_wallets
+// of the action first, then the wallets of the pipline.
+func (v *ValidatorWallets) Get(address string) (*wallet.Wallet, string) {
+	if wlt, ok := v.wallets[address]; ok {
+		return wlt, v.passwords[address]
+	}
+
+	return v.pipline.GetValidatorWallet(address)
+}
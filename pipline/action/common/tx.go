@@ -0,0 +1,41 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/pactus-project/pactus/types/tx"
+	"github.com/pactus-project/pactus/wallet"
+)
+
+// SignAndBroadcast signs the transaction with the wallet key and broadcasts it,
+// returning the transaction hash. Nothing is signed once the context is
+// canceled, but a signed transaction is always broadcast.
+func SignAndBroadcast(ctx context.Context, wlt *wallet.Wallet, password string, trx *tx.Tx) (string, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return "", fmt.Errorf("transaction not sent, shutting down: %w", err)
+	}
+
+	err = wlt.SignTransaction(password, trx)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	bs, _ := trx.Bytes()
+
+	log.Printf("Signed transaction data: %x", bs)
+
+	res, err := wlt.BroadcastTransaction(trx)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to broadcast transaction: %w", err)
+	}
+
+	log.Printf("Transaction hash: %s", res)
+
+	return res, nil
+}
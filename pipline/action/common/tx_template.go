@@ -0,0 +1,128 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/wallet"
+)
+
+const maxMemoLength = 64
+
+var memoPlaceholders = map[string]bool{
+	"{pipeline}":  true,
+	"{action}":    true,
+	"{run_id}":    true,
+	"{validator}": true,
+}
+
+var memoBraces = regexp.MustCompile(`\{[^{}]*\}`)
+
+// TxTemplate holds the memo template and lock time offset of an action,
+// shared by all the transactions the action generates.
+type TxTemplate struct {
+	pipline        provider.PiplineProvider
+	action         string
+	memo           string
+	lockTimeOffset uint32
+}
+
+func CreateTxTemplate(pipline provider.PiplineProvider, actionConfig *config.Action) (*TxTemplate, error) {
+	action := actionConfig.Name
+
+	if action == "" {
+		action = actionConfig.Type
+	}
+
+	err := checkMemo(actionConfig.Memo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxTemplate{
+		pipline:        pipline,
+		action:         action,
+		memo:           actionConfig.Memo,
+		lockTimeOffset: actionConfig.LockTimeOffset,
+	}, nil
+}
+
+// checkMemo rejects unknown placeholders and unbalanced braces in the memo
+// template, so a typo fails at startup rather than at the first broadcast.
+func checkMemo(memo string) error {
+	for _, placeholder := range memoBraces.FindAllString(memo, -1) {
+		if !memoPlaceholders[placeholder] {
+			return fmt.Errorf("unknown placeholder %s in memo %q", placeholder, memo)
+		}
+	}
+
+	if strings.ContainsAny(memoBraces.ReplaceAllString(memo, ""), "{}") {
+		return fmt.Errorf("unbalanced brace in memo %q", memo)
+	}
+
+	return nil
+}
+
+// Memo renders the memo template. Supported placeholders are
+// {pipeline}, {action}, {run_id} and {validator}.
+func (t *TxTemplate) Memo(runID, validator string) string {
+	memo := strings.NewReplacer(
+		"{pipeline}", t.pipline.GetName(),
+		"{action}", t.action,
+		"{run_id}", runID,
+		"{validator}", validator,
+	).Replace(t.memo)
+
+	if len(memo) > maxMemoLength {
+		log.Printf("memo %q is longer than %d bytes, truncated", memo, maxMemoLength)
+
+		// cut before the rune that does not fit, to keep valid UTF-8
+		end := maxMemoLength
+
+		for end > 0 && !utf8.RuneStart(memo[end]) {
+			end--
+		}
+
+		memo = memo[:end]
+	}
+
+	return memo
+}
+
+// ConfirmTimeout extends the confirm timeout by the lock time offset, a
+// transaction is not included in a block before its lock time.
+func (t *TxTemplate) ConfirmTimeout(timeout time.Duration) time.Duration {
+	if t.lockTimeOffset == 0 {
+		return timeout
+	}
+
+	return timeout + time.Duration(t.lockTimeOffset)*t.pipline.GetConsensusParams().BlockInterval()
+}
+
+// Options returns the memo and lock time options of a transaction.
+func (t *TxTemplate) Options(runID, validator string) ([]wallet.TxOption, error) {
+	opts := []wallet.TxOption{}
+
+	if t.memo != "" {
+		opts = append(opts, wallet.OptionMemo(t.Memo(runID, validator)))
+	}
+
+	if t.lockTimeOffset > 0 {
+		info, err := t.pipline.GetBlockchainInfo()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blockchain info: %w", err)
+		}
+
+		opts = append(opts, wallet.OptionLockTime(info.LastBlockHeight+t.lockTimeOffset))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/provider"
+)
+
+// namedPipline only implements GetName, the rest of the provider is not used
+// to render a memo.
+type namedPipline struct {
+	provider.PiplineProvider
+	name string
+}
+
+func (p *namedPipline) GetName() string {
+	return p.name
+}
+
+func TestCreateTxTemplateMemo(t *testing.T) {
+	for _, memo := range []string{
+		"",
+		"staking",
+		"{pipeline}/{action} {run_id}",
+		"{validator}",
+	} {
+		_, err := CreateTxTemplate(&namedPipline{}, &config.Action{Type: "bond", Memo: memo})
+		if err != nil {
+			t.Errorf("%q: %v", memo, err)
+		}
+	}
+
+	for _, memo := range []string{
+		"{pipline}",
+		"{run-id}",
+		"{}",
+		"{action",
+		"action}",
+		"{{action}}",
+	} {
+		_, err := CreateTxTemplate(&namedPipline{}, &config.Action{Type: "bond", Memo: memo})
+		if err == nil {
+			t.Errorf("%q: expected an error", memo)
+		}
+	}
+}
+
+func TestMemoTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+		want     string
+	}{
+		{"short", "质押", "质押/bond"},
+		// 21 runes of 3 bytes are 63 bytes, the 22nd does not fit
+		{"cut before a multi-byte rune", strings.Repeat("质", 30), strings.Repeat("质", 21)},
+		{"cut on a rune boundary", "a" + strings.Repeat("质", 30), "a" + strings.Repeat("质", 21)},
+		{"ascii", strings.Repeat("a", 70), strings.Repeat("a", 64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := CreateTxTemplate(&namedPipline{name: tt.pipeline}, &config.Action{Type: "bond", Memo: "{pipeline}/{action}"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := template.Memo("run", "")
+
+			if !utf8.ValidString(got) || len(got) > maxMemoLength {
+				t.Errorf("invalid memo %q (%d bytes)", got, len(got))
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
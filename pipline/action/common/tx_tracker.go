@@ -0,0 +1,223 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/frimin/pactus-staker/pipline/provider"
+)
+
+const (
+	TxConfirmed = "confirmed"
+	TxDropped   = "dropped"
+	TxTimedOut  = "timed out"
+	// TxInterrupted is set when the process shuts down before the transaction
+	// is confirmed, it may still be included in a block
+	TxInterrupted = "interrupted"
+)
+
+const txPollInterval = 2 * time.Second
+
+// UnconfirmedError is returned when transactions of a run timed out or were
+// interrupted. They may still be included in a block, so the run is not
+// retried, a retry could send them twice.
+type UnconfirmedError struct {
+	Err error
+}
+
+func (e *UnconfirmedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnconfirmedError) Unwrap() error {
+	return e.Err
+}
+
+type TxResult struct {
+	ID     string
+	Status string
+	Height uint32
+}
+
+// TxTracker follows the broadcast transactions of a run until they are included
+// in a block, removed from the transaction pool, the timeout is hit or the
+// process shuts down.
+type TxTracker struct {
+	pipline provider.PiplineProvider
+	timeout time.Duration
+	pending []string
+	results []TxResult
+}
+
+func CreateTxTracker(pipline provider.PiplineProvider, timeout time.Duration) *TxTracker {
+	return &TxTracker{
+		pipline: pipline,
+		timeout: timeout,
+		pending: make([]string, 0),
+		results: make([]TxResult, 0),
+	}
+}
+
+// Add tracks a broadcast transaction, it is waited for by the next WaitAll.
+func (t *TxTracker) Add(id string) {
+	t.pending = append(t.pending, id)
+}
+
+// Wait waits for a single tracked transaction.
+func (t *TxTracker) Wait(id string) TxResult {
+	for i, pendingID := range t.pending {
+		if pendingID == id {
+			t.pending = append(t.pending[:i], t.pending[i+1:]...)
+			break
+		}
+	}
+
+	return t.wait([]string{id})[0]
+}
+
+// WaitAll waits for all the tracked transactions that were not waited for yet.
+func (t *TxTracker) WaitAll() []TxResult {
+	ids := t.pending
+	t.pending = make([]string, 0)
+
+	return t.wait(ids)
+}
+
+func (t *TxTracker) wait(ids []string) []TxResult {
+	results := make([]TxResult, len(ids))
+	done := make([]bool, len(ids))
+	remaining := len(ids)
+	deadline := t.pipline.GetClock().Now().Add(t.timeout)
+
+	for remaining > 0 {
+		if t.pipline.GetContext().Err() != nil {
+			for i, id := range ids {
+				if !done[i] {
+					results[i] = TxResult{ID: id, Status: TxInterrupted}
+				}
+			}
+			break
+		}
+
+		for i, id := range ids {
+			if done[i] {
+				continue
+			}
+
+			status, height := t.check(id)
+
+			if status == "" {
+				continue
+			}
+
+			results[i] = TxResult{ID: id, Status: status, Height: height}
+			done[i] = true
+			remaining--
+		}
+
+		if remaining == 0 {
+			break
+		}
+
+		if t.pipline.GetClock().Now().After(deadline) {
+			for i, id := range ids {
+				if !done[i] {
+					results[i] = TxResult{ID: id, Status: TxTimedOut}
+				}
+			}
+			break
+		}
+
+		select {
+		case <-t.pipline.GetContext().Done():
+		case <-t.pipline.GetClock().After(txPollInterval):
+		}
+	}
+
+	for _, result := range results {
+		log.Printf("[tx confirm] tx=%v status=%v height=%v", result.ID, result.Status, result.Height)
+	}
+
+	t.results = append(t.results, results...)
+
+	return results
+}
+
+// check returns the status of a transaction, or an empty status if it is still
+// waiting in the transaction pool or can not be queried right now.
+func (t *TxTracker) check(id string) (string, uint32) {
+	committed, err := t.pipline.GetTransaction(id)
+
+	if err != nil {
+		log.Printf("[tx confirm] tx=%v failed to get transaction: %v", id, err)
+		return "", 0
+	}
+
+	if committed != nil {
+		return TxConfirmed, committed.BlockHeight
+	}
+
+	txs, err := t.pipline.GetTxPoolContent()
+
+	if err != nil {
+		log.Printf("[tx confirm] tx=%v failed to get transaction pool: %v", id, err)
+		return "", 0
+	}
+
+	for _, trx := range txs {
+		if trx.Id == id {
+			return "", 0
+		}
+	}
+
+	// it may have been committed between the two queries
+	committed, err = t.pipline.GetTransaction(id)
+
+	if err != nil {
+		return "", 0
+	}
+
+	if committed != nil {
+		return TxConfirmed, committed.BlockHeight
+	}
+
+	return TxDropped, 0
+}
+
+// Report waits for the remaining transactions and returns an error if any
+// transaction of the run was dropped, timed out or interrupted by a shutdown.
+// The error is an UnconfirmedError unless all of them were dropped.
+func (t *TxTracker) Report() error {
+	t.WaitAll()
+
+	dropped, timedOut, interrupted := 0, 0, 0
+
+	for _, result := range t.results {
+		switch result.Status {
+		case TxDropped:
+			dropped++
+		case TxTimedOut:
+			timedOut++
+		case TxInterrupted:
+			interrupted++
+		}
+	}
+
+	notConfirmed := dropped + timedOut + interrupted
+
+	log.Printf("[tx confirm] confirmed=%d dropped=%d timed_out=%d interrupted=%d", len(t.results)-notConfirmed, dropped, timedOut, interrupted)
+
+	if notConfirmed == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%d of %d transactions not confirmed: %d dropped, %d timed out, %d interrupted",
+		notConfirmed, len(t.results), dropped, timedOut, interrupted)
+
+	if timedOut+interrupted > 0 {
+		return &UnconfirmedError{Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+package consolidate
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/bond"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/types/amount"
+	"github.com/pactus-project/pactus/wallet"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+type ConsolidateAction struct {
+	pipline     provider.PiplineProvider
+	txTemplate  *common.TxTemplate
+	collector   string
+	reserveFees amount.Amount
+	fees        *common.FeePolicy
+	filter      *common.Filter
+	limits      *bond.StakeLimits
+}
+
+func CreateConsolidateAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*ConsolidateAction, error) {
+	if wlt, _ := pipline.GetAccountWallet(actionConfig.Collector); wlt == nil {
+		return nil, fmt.Errorf("collector is not an account of the pipline reward wallets: %s", actionConfig.Collector)
+	}
+
+	reserveFees, err := amount.NewAmount(optionsConfig.ReserveFees)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reserve fees: %w", err)
+	}
+
+	fees, err := common.CreateFeePolicy(pipline, optionsConfig, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := bond.CreateStakeLimits(pipline.GetConsensusParams(), actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := common.CreateFilter(actionConfig.Filter, pipline.GetAddressLabels())
+
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &ConsolidateAction{
+		pipline:     pipline,
+		txTemplate:  txTemplate,
+		collector:   actionConfig.Collector,
+		reserveFees: reserveFees,
+		fees:        fees,
+		filter:      filter,
+		limits:      limits,
+	}
+
+	log.Printf("Pipline %s action %d consolidate to %s", action.pipline.GetName(), index, action.collector)
+
+	return action, nil
+}
+
+func (p *ConsolidateAction) GetName() string {
+	return "consolidate"
+}
+
+func (p *ConsolidateAction) GetValidatorAddresses() []string {
+	return []string{}
+}
+
+func (p *ConsolidateAction) GetFilter() *common.Filter {
+	return p.filter
+}
+
+func (p *ConsolidateAction) Run(runID string) error {
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_TRANSFER)
+
+	if err != nil {
+		return err
+	}
+
+	addresses, amounts, err := p.pipline.GetAllBalance()
+
+	if err != nil {
+		return fmt.Errorf("failed to get all balances: %w", err)
+	}
+
+	consolidated := amount.Amount(0)
+
+	for accountIndex, accountAddress := range addresses {
+		if accountAddress == p.collector {
+			continue
+		}
+
+		if !p.filter.AllowAccount(accountAddress) {
+			log.Printf("[account facts] - %s - excluded", accountAddress)
+			continue
+		}
+
+		balance := amounts[accountIndex]
+
+		if balance > (p.reserveFees + p.limits.Min) {
+			// enough to be bonded by the bond action itself
+			continue
+		}
+
+		if balance <= p.reserveFees+fee {
+			// not worth the fee
+			continue
+		}
+
+		dust := balance - common.Reserve(p.reserveFees, fee)
+
+		wlt, password := p.pipline.GetAccountWallet(accountAddress)
+
+		if wlt == nil {
+			return fmt.Errorf("failed to get wallet for address: %s", accountAddress)
+		}
+
+		log.Printf("[account consolidate] from=%v to=%v amount=%v fee=%v", accountAddress, p.collector, dust, fee)
+
+		opts, err := p.txTemplate.Options(runID, "")
+
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, wallet.OptionFee(fee.String()))
+
+		trx, err := wlt.MakeTransferTx(accountAddress, p.collector, dust, opts...)
+
+		if err != nil {
+			return fmt.Errorf("failed to make transfer transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return err
+		}
+
+		consolidated += dust
+	}
+
+	log.Printf("[account consolidate] total consolidated: %v", consolidated)
+
+	return nil
+}
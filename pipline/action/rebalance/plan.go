@@ -0,0 +1,172 @@
+package rebalance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+type unbondStep struct {
+	Address         string        `json:"address"`
+	Stake           amount.Amount `json:"stake"`
+	Unbonded        bool          `json:"unbonded"`
+	UnbondingHeight uint32        `json:"unbonding_height"`
+	Withdrawn       bool          `json:"withdrawn"`
+}
+
+type bondStep struct {
+	Address string        `json:"address"`
+	Amount  amount.Amount `json:"amount"`
+	Bonded  bool          `json:"bonded"`
+}
+
+// plan is persisted between runs, because the stake of an unbonded validator
+// can only be withdrawn after the unbonding period (about 21 days).
+type plan struct {
+	CreatedAt time.Time     `json:"created_at"`
+	Unbond    []*unbondStep `json:"unbond"`
+	Bond      []*bondStep   `json:"bond"`
+}
+
+type validatorStake struct {
+	address string
+	stake   amount.Amount
+	healthy bool
+}
+
+// makePlan computes the target distribution. Pactus can only unbond a validator
+// entirely, so over-weighted validators are unbonded one by one (heaviest first)
+// until the rest are within tolerance of the even target, then the released stake
+// is planned to be bonded into the remaining validators, lowest stake first.
+// An over-weighted validator is kept if the remaining validators can not take
+// all the released stake under the max stake.
+func makePlan(validators []validatorStake, maxStake, minStake, tolerance amount.Amount) *plan {
+	result := &plan{
+		Unbond: make([]*unbondStep, 0),
+		Bond:   make([]*bondStep, 0),
+	}
+
+	total := amount.Amount(0)
+	remaining := make([]validatorStake, 0)
+
+	for _, v := range validators {
+		total += v.stake
+
+		if v.healthy {
+			remaining = append(remaining, v)
+		} else if v.stake > 0 {
+			result.Unbond = append(result.Unbond, &unbondStep{Address: v.address, Stake: v.stake})
+		}
+	}
+
+	if len(remaining) == 0 {
+		return result
+	}
+
+	sort.SliceStable(remaining, func(i, j int) bool {
+		return remaining[i].stake < remaining[j].stake
+	})
+
+	target := func() amount.Amount {
+		t := total / amount.Amount(len(remaining))
+		if t > maxStake {
+			t = maxStake
+		}
+		return t
+	}
+
+	released := amount.Amount(0)
+
+	for _, step := range result.Unbond {
+		released += step.Stake
+	}
+
+	for len(remaining) > 1 {
+		heaviest := remaining[len(remaining)-1]
+
+		if heaviest.stake <= target()+tolerance {
+			break
+		}
+
+		if capacity(remaining[:len(remaining)-1], maxStake) < released+heaviest.stake {
+			break
+		}
+
+		released += heaviest.stake
+
+		result.Unbond = append(result.Unbond, &unbondStep{Address: heaviest.address, Stake: heaviest.stake})
+		remaining = remaining[:len(remaining)-1]
+	}
+
+	if len(result.Unbond) == 0 {
+		return result
+	}
+
+	t := target()
+
+	for _, v := range remaining {
+		if v.stake+minStake > t {
+			continue
+		}
+
+		result.Bond = append(result.Bond, &bondStep{Address: v.address, Amount: t - v.stake})
+	}
+
+	return result
+}
+
+// capacity is the stake the validators can still take under the max stake.
+func capacity(validators []validatorStake, maxStake amount.Amount) amount.Amount {
+	result := amount.Amount(0)
+
+	for _, v := range validators {
+		if v.stake < maxStake {
+			result += maxStake - v.stake
+		}
+	}
+
+	return result
+}
+
+func (p *plan) isEmpty() bool {
+	return len(p.Unbond) == 0 && len(p.Bond) == 0
+}
+
+func loadPlan(filename string) (*plan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read rebalance state: %w", err)
+	}
+
+	var result plan
+
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rebalance state: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (p *plan) save(filename string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = common.WriteFileAtomic(filename, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write rebalance state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package rebalance
+
+import (
+	"testing"
+
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+func pac(f float64) amount.Amount {
+	a, _ := amount.NewAmount(f)
+
+	return a
+}
+
+func TestMakePlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		validators []validatorStake
+		tolerance  amount.Amount
+		wantUnbond []string
+		wantBond   []bondStep
+	}{
+		{
+			name:       "drift within tolerance",
+			validators: []validatorStake{{"val1", pac(1000), true}, {"val2", pac(999), true}},
+			tolerance:  pac(1),
+		},
+		{
+			name:       "no room for the released stake",
+			validators: []validatorStake{{"val1", pac(1000), true}, {"val2", pac(999), true}},
+		},
+		{
+			name:       "no room for the released stake with several validators",
+			validators: []validatorStake{{"val1", pac(900), true}, {"val2", pac(900), true}, {"val3", pac(1000), true}},
+			tolerance:  pac(1),
+		},
+		{
+			name:       "over-weighted validator unbonded",
+			validators: []validatorStake{{"val1", pac(100), true}, {"val2", pac(100), true}, {"val3", pac(700), true}},
+			tolerance:  pac(1),
+			wantUnbond: []string{"val3"},
+			wantBond:   []bondStep{{Address: "val1", Amount: pac(350)}, {Address: "val2", Amount: pac(350)}},
+		},
+		{
+			name:       "unhealthy validator unbonded",
+			validators: []validatorStake{{"val1", pac(500), false}, {"val2", pac(200), true}, {"val3", pac(300), true}},
+			tolerance:  pac(1),
+			wantUnbond: []string{"val1"},
+			wantBond:   []bondStep{{Address: "val2", Amount: pac(300)}, {Address: "val3", Amount: pac(200)}},
+		},
+		{
+			name:       "unhealthy stake spread to the even target",
+			validators: []validatorStake{{"val1", pac(900), false}, {"val2", pac(200), true}, {"val3", pac(800), true}},
+			tolerance:  pac(1),
+			wantUnbond: []string{"val1"},
+			wantBond:   []bondStep{{Address: "val2", Amount: pac(750)}, {Address: "val3", Amount: pac(150)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := makePlan(tt.validators, pac(1000), pac(1), tt.tolerance)
+
+			if len(got.Unbond) != len(tt.wantUnbond) {
+				t.Fatalf("got %d unbonds, want %v", len(got.Unbond), tt.wantUnbond)
+			}
+
+			for i, step := range got.Unbond {
+				if step.Address != tt.wantUnbond[i] {
+					t.Errorf("unbond %d: got %s, want %s", i, step.Address, tt.wantUnbond[i])
+				}
+			}
+
+			if len(got.Bond) != len(tt.wantBond) {
+				t.Fatalf("got %d bonds, want %v", len(got.Bond), tt.wantBond)
+			}
+
+			for i, step := range got.Bond {
+				if step.Address != tt.wantBond[i].Address || step.Amount != tt.wantBond[i].Amount {
+					t.Errorf("bond %d: got %s %s, want %s %s", i, step.Address, step.Amount, tt.wantBond[i].Address, tt.wantBond[i].Amount)
+				}
+			}
+		})
+	}
+}
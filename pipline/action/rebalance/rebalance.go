@@ -0,0 +1,527 @@
+package rebalance
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/bond"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/types/amount"
+	"github.com/pactus-project/pactus/wallet"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+type RebalanceAction struct {
+	validatorAddresses     []string
+	validatorWallets       *common.ValidatorWallets
+	filter                 *common.Filter
+	pipline                provider.PiplineProvider
+	txTemplate             *common.TxTemplate
+	rewardAccount          string
+	stateFile              string
+	availabilityScoreBelow float64
+	tolerance              amount.Amount
+	reserveFees            amount.Amount
+	fees                   *common.FeePolicy
+	limits                 *bond.StakeLimits
+	unbondInterval         uint32
+}
+
+func CreateRebalanceAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*RebalanceAction, error) {
+	if wlt, _ := pipline.GetAccountWallet(actionConfig.RewardAccount); wlt == nil {
+		return nil, fmt.Errorf("reward account is not an account of the pipline reward wallets: %s", actionConfig.RewardAccount)
+	}
+
+	if actionConfig.StateFile == "" {
+		return nil, fmt.Errorf("state_file is required for rebalance action")
+	}
+
+	reserveFees, err := amount.NewAmount(optionsConfig.ReserveFees)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reserve fees: %w", err)
+	}
+
+	fees, err := common.CreateFeePolicy(pipline, optionsConfig, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := bond.CreateStakeLimits(pipline.GetConsensusParams(), actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// an unbonded validator can never bond again, so a drift of a few
+	// NanoPAC must not unbond it
+	tolerance := limits.Min
+
+	if actionConfig.Tolerance != 0 {
+		tolerance, err = amount.NewAmount(actionConfig.Tolerance)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tolerance: %w", err)
+		}
+
+		if tolerance < limits.Min {
+			return nil, fmt.Errorf("tolerance %s is below the min stake %s", tolerance, limits.Min)
+		}
+	}
+
+	targets, err := common.LoadTargets(actionConfig.Targets, actionConfig.TargetsFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	validatorWallets, err := common.OpenValidatorWallets(pipline, actionConfig.ValidatorWallets)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := pipline.GetAddressLabels()
+
+	common.AddLabels(labels, targets)
+
+	filter, err := common.CreateFilter(actionConfig.Filter, labels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &RebalanceAction{
+		validatorAddresses:     targets.Addresses,
+		validatorWallets:       validatorWallets,
+		filter:                 filter,
+		pipline:                pipline,
+		txTemplate:             txTemplate,
+		rewardAccount:          actionConfig.RewardAccount,
+		stateFile:              actionConfig.StateFile,
+		availabilityScoreBelow: actionConfig.Conditions.AvailabilityScoreBelow,
+		tolerance:              tolerance,
+		reserveFees:            reserveFees,
+		fees:                   fees,
+		limits:                 limits,
+		unbondInterval:         pipline.GetConsensusParams().UnbondInterval,
+	}
+
+	log.Printf("Pipline %s action %d has %d rebalance targets", action.pipline.GetName(), index, len(action.validatorAddresses))
+
+	for _, address := range action.validatorAddresses {
+		wlt, _ := action.validatorWallets.Get(address)
+
+		if wlt == nil {
+			return nil, fmt.Errorf("no wallet holds the key of validator: %s", address)
+		}
+	}
+
+	existingPlan, err := loadPlan(action.stateFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existingPlan != nil {
+		log.Printf("Resume rebalance plan created at %s", existingPlan.CreatedAt)
+	}
+
+	return action, nil
+}
+
+func (p *RebalanceAction) GetName() string {
+	return "rebalance"
+}
+
+func (p *RebalanceAction) GetValidatorAddresses() []string {
+	return p.validatorAddresses
+}
+
+func (p *RebalanceAction) GetFilter() *common.Filter {
+	return p.filter
+}
+
+func (p *RebalanceAction) createPlan() (*plan, error) {
+	validators := make([]validatorStake, 0, len(p.validatorAddresses))
+
+	for _, address := range p.validatorAddresses {
+		if !p.filter.AllowValidator(address) {
+			log.Printf("[rebalance facts] validator=%v excluded", address)
+			continue
+		}
+
+		stake, validatorInfo, err := p.pipline.GetValidatorStake(address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if validatorInfo == nil || validatorInfo.UnbondingHeight != 0 {
+			// not created yet or already leaving, not part of the distribution
+			continue
+		}
+
+		healthy := p.availabilityScoreBelow <= 0 || validatorInfo.AvailabilityScore >= p.availabilityScoreBelow
+
+		log.Printf("[rebalance facts] validator=%v stake=%v score=%v healthy=%v", address, stake, validatorInfo.AvailabilityScore, healthy)
+
+		validators = append(validators, validatorStake{
+			address: address,
+			stake:   stake,
+			healthy: healthy,
+		})
+	}
+
+	result := makePlan(validators, p.limits.Max, p.limits.Min, p.tolerance)
+	result.CreatedAt = p.pipline.GetClock().Now()
+
+	return result, nil
+}
+
+func (p *RebalanceAction) Run(runID string) error {
+	currentPlan, err := loadPlan(p.stateFile)
+
+	if err != nil {
+		return err
+	}
+
+	if currentPlan == nil {
+		currentPlan, err = p.createPlan()
+
+		if err != nil {
+			return err
+		}
+
+		if currentPlan.isEmpty() {
+			log.Printf("[rebalance] stake is balanced, nothing to do")
+			return nil
+		}
+
+		for _, step := range currentPlan.Unbond {
+			log.Printf("[rebalance plan] unbond validator=%v stake=%v", step.Address, step.Stake)
+		}
+
+		for _, step := range currentPlan.Bond {
+			log.Printf("[rebalance plan] bond validator=%v amount=%v", step.Address, step.Amount)
+		}
+
+		err = currentPlan.save(p.stateFile)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := p.runUnbond(runID, currentPlan); err != nil {
+		return err
+	}
+
+	ready, err := p.runWithdraw(runID, currentPlan)
+
+	if err != nil {
+		return err
+	}
+
+	if !ready {
+		return nil
+	}
+
+	if err := p.runBond(runID, currentPlan); err != nil {
+		return err
+	}
+
+	log.Printf("[rebalance] plan completed")
+
+	return os.Remove(p.stateFile)
+}
+
+// runUnbond sends the unbond of the validators whose unbond is not on chain
+// yet. A step is only marked done once the chain shows the validator unbonding,
+// so a dropped unbond is sent again by the next run.
+func (p *RebalanceAction) runUnbond(runID string, currentPlan *plan) error {
+	steps := make([]*unbondStep, 0, len(currentPlan.Unbond))
+
+	for _, step := range currentPlan.Unbond {
+		if step.Unbonded {
+			steps = append(steps, step)
+			continue
+		}
+
+		_, validatorInfo, err := p.pipline.GetValidatorStake(step.Address)
+
+		if err != nil {
+			return err
+		}
+
+		if validatorInfo == nil {
+			log.Printf("[rebalance unbond] validator=%v not found, drop it from the plan", step.Address)
+			continue
+		}
+
+		steps = append(steps, step)
+
+		if validatorInfo.UnbondingHeight != 0 {
+			log.Printf("[rebalance unbond] validator=%v unbonded at height %v", step.Address, validatorInfo.UnbondingHeight)
+
+			step.Unbonded = true
+			step.UnbondingHeight = validatorInfo.UnbondingHeight
+			continue
+		}
+
+		pending, err := p.pendingInPool(pactus.PayloadType_PAYLOAD_TYPE_UNBOND, step.Address)
+
+		if err != nil {
+			return err
+		}
+
+		if pending {
+			log.Printf("[rebalance unbond] validator=%v unbond waiting in the transaction pool", step.Address)
+			continue
+		}
+
+		wlt, password := p.validatorWallets.Get(step.Address)
+
+		if wlt == nil {
+			return fmt.Errorf("failed to get wallet for validator: %s", step.Address)
+		}
+
+		log.Printf("[rebalance unbond] validator=%v stake=%v", step.Address, step.Stake)
+
+		opts, err := p.txTemplate.Options(runID, step.Address)
+
+		if err != nil {
+			return err
+		}
+
+		trx, err := wlt.MakeUnbondTx(step.Address, opts...)
+
+		if err != nil {
+			return fmt.Errorf("failed to make unbond transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	currentPlan.Unbond = steps
+
+	return currentPlan.save(p.stateFile)
+}
+
+// runWithdraw returns true once the stake of every unbonded validator has been
+// withdrawn. Like the unbond, a step is only marked done from the chain, once
+// the validator has no stake left to withdraw.
+func (p *RebalanceAction) runWithdraw(runID string, currentPlan *plan) (bool, error) {
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_WITHDRAW)
+
+	if err != nil {
+		return false, err
+	}
+
+	info, err := p.pipline.GetBlockchainInfo()
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get blockchain info: %w", err)
+	}
+
+	ready := true
+
+	for _, step := range currentPlan.Unbond {
+		if step.Withdrawn {
+			continue
+		}
+
+		if !step.Unbonded {
+			log.Printf("[rebalance withdraw] validator=%v unbond not confirmed yet", step.Address)
+			ready = false
+			continue
+		}
+
+		stake, _, err := p.pipline.GetValidatorStake(step.Address)
+
+		if err != nil {
+			return false, err
+		}
+
+		// what is left can not pay the fee of a withdraw
+		if stake <= fee {
+			log.Printf("[rebalance withdraw] validator=%v withdrawn", step.Address)
+
+			step.Withdrawn = true
+			continue
+		}
+
+		ready = false
+
+		withdrawableHeight := step.UnbondingHeight + p.unbondInterval
+
+		if info.LastBlockHeight < withdrawableHeight {
+			log.Printf("[rebalance withdraw] validator=%v withdrawable at height %v (current %v)", step.Address, withdrawableHeight, info.LastBlockHeight)
+			continue
+		}
+
+		pending, err := p.pendingInPool(pactus.PayloadType_PAYLOAD_TYPE_WITHDRAW, step.Address)
+
+		if err != nil {
+			return false, err
+		}
+
+		if pending {
+			log.Printf("[rebalance withdraw] validator=%v withdraw waiting in the transaction pool", step.Address)
+			continue
+		}
+
+		wlt, password := p.validatorWallets.Get(step.Address)
+
+		if wlt == nil {
+			return false, fmt.Errorf("failed to get wallet for validator: %s", step.Address)
+		}
+
+		log.Printf("[rebalance withdraw] validator=%v withdraw=%v fee=%v to=%v", step.Address, stake-fee, fee, p.rewardAccount)
+
+		opts, err := p.txTemplate.Options(runID, step.Address)
+
+		if err != nil {
+			return false, err
+		}
+
+		opts = append(opts, wallet.OptionFee(fee.String()))
+
+		trx, err := wlt.MakeWithdrawTx(step.Address, p.rewardAccount, stake-fee, opts...)
+
+		if err != nil {
+			return false, fmt.Errorf("failed to make withdraw transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := currentPlan.save(p.stateFile); err != nil {
+		return false, err
+	}
+
+	// the withdrawn stake is in the balance once the chain shows it withdrawn
+	return ready, nil
+}
+
+// pendingInPool reports whether an unbond or withdraw of the validator is
+// waiting in the transaction pool, so it is not sent twice.
+func (p *RebalanceAction) pendingInPool(payloadType pactus.PayloadType, validatorAddress string) (bool, error) {
+	txs, err := p.pipline.GetTxPoolContent()
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get transaction pool: %w", err)
+	}
+
+	for _, trx := range txs {
+		if trx.PayloadType != payloadType {
+			continue
+		}
+
+		if trx.GetUnbond().GetValidator() == validatorAddress || trx.GetWithdraw().GetValidatorAddress() == validatorAddress {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *RebalanceAction) runBond(runID string, currentPlan *plan) error {
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_BOND)
+
+	if err != nil {
+		return err
+	}
+
+	wlt, password := p.pipline.GetAccountWallet(p.rewardAccount)
+
+	if wlt == nil {
+		return fmt.Errorf("failed to get wallet for address: %s", p.rewardAccount)
+	}
+
+	balance, err := wlt.Balance(p.rewardAccount)
+
+	if err != nil {
+		return fmt.Errorf("failed to get balance of %s: %w", p.rewardAccount, err)
+	}
+
+	for _, step := range currentPlan.Bond {
+		if step.Bonded {
+			continue
+		}
+
+		stake, _, err := p.pipline.GetValidatorStake(step.Address)
+
+		if err != nil {
+			return err
+		}
+
+		bondAmount := step.Amount
+
+		if bondAmount > p.limits.Max-stake {
+			bondAmount = p.limits.Max - stake
+		}
+
+		reserve := common.Reserve(p.reserveFees, fee)
+
+		if balance <= reserve {
+			return fmt.Errorf("reward account %s has not enough balance: %s", p.rewardAccount, balance)
+		}
+
+		if bondAmount > balance-reserve {
+			bondAmount = balance - reserve
+		}
+
+		if bondAmount >= p.limits.Min {
+			log.Printf("[rebalance bond] validator=%v bond=%v fee=%v", step.Address, bondAmount, fee)
+
+			opts, err := p.txTemplate.Options(runID, step.Address)
+
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, wallet.OptionFee(fee.String()))
+
+			trx, err := wlt.MakeBondTx(p.rewardAccount, step.Address, "", bondAmount, opts...)
+
+			if err != nil {
+				return fmt.Errorf("failed to make bond transaction: %w", err)
+			}
+
+			_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+			if err != nil {
+				return err
+			}
+
+			balance -= bondAmount + fee
+		}
+
+		step.Bonded = true
+
+		if err := currentPlan.save(p.stateFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
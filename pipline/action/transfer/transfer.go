@@ -0,0 +1,180 @@
+package transfer
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/crypto"
+	"github.com/pactus-project/pactus/types/amount"
+	"github.com/pactus-project/pactus/wallet"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+type TransferAction struct {
+	pipline     provider.PiplineProvider
+	txTemplate  *common.TxTemplate
+	destination string
+	floor       amount.Amount
+	maxPerRun   amount.Amount
+	reserveFees amount.Amount
+	fees        *common.FeePolicy
+	filter      *common.Filter
+}
+
+func CreateTransferAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*TransferAction, error) {
+	addr, err := crypto.AddressFromString(actionConfig.Destination)
+
+	if err != nil || !addr.IsAccountAddress() {
+		return nil, fmt.Errorf("invalid destination address: %s", actionConfig.Destination)
+	}
+
+	floor, err := amount.NewAmount(actionConfig.Floor)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create floor: %w", err)
+	}
+
+	maxPerRun, err := amount.NewAmount(actionConfig.MaxPerRun)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create max per run: %w", err)
+	}
+
+	reserveFees, err := amount.NewAmount(optionsConfig.ReserveFees)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reserve fees: %w", err)
+	}
+
+	fees, err := common.CreateFeePolicy(pipline, optionsConfig, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := common.CreateFilter(actionConfig.Filter, pipline.GetAddressLabels())
+
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &TransferAction{
+		pipline:     pipline,
+		txTemplate:  txTemplate,
+		destination: actionConfig.Destination,
+		floor:       floor,
+		maxPerRun:   maxPerRun,
+		reserveFees: reserveFees,
+		fees:        fees,
+		filter:      filter,
+	}
+
+	log.Printf("Pipline %s action %d transfer to %s (floor: %s, max per run: %s)", action.pipline.GetName(), index, action.destination, action.floor, action.maxPerRun)
+
+	return action, nil
+}
+
+func (p *TransferAction) GetName() string {
+	return "transfer"
+}
+
+func (p *TransferAction) GetValidatorAddresses() []string {
+	return []string{}
+}
+
+func (p *TransferAction) GetFilter() *common.Filter {
+	return p.filter
+}
+
+func (p *TransferAction) Run(runID string) error {
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_TRANSFER)
+
+	if err != nil {
+		return err
+	}
+
+	addresses, amounts, err := p.pipline.GetAllBalance()
+
+	if err != nil {
+		return fmt.Errorf("failed to get all balances: %w", err)
+	}
+
+	transferred := amount.Amount(0)
+
+	for accountIndex, accountAddress := range addresses {
+		if accountAddress == p.destination {
+			continue
+		}
+
+		if !p.filter.AllowAccount(accountAddress) {
+			log.Printf("[account facts] - %s - excluded", accountAddress)
+			continue
+		}
+
+		balance := amounts[accountIndex]
+
+		log.Printf("[account facts] - %s - balance: %s", accountAddress, balance)
+
+		reserve := common.Reserve(p.reserveFees, fee)
+
+		if balance <= reserve+p.floor {
+			continue
+		}
+
+		transferAmount := balance - reserve - p.floor
+
+		if p.maxPerRun > 0 {
+			if transferred >= p.maxPerRun {
+				log.Printf("[account transfer] reached max per run %v", p.maxPerRun)
+				break
+			}
+
+			if transferAmount > p.maxPerRun-transferred {
+				transferAmount = p.maxPerRun - transferred
+			}
+		}
+
+		wlt, password := p.pipline.GetAccountWallet(accountAddress)
+
+		if wlt == nil {
+			return fmt.Errorf("failed to get wallet for address: %s", accountAddress)
+		}
+
+		log.Printf("[account transfer] from=%v to=%v amount=%v fee=%v", accountAddress, p.destination, transferAmount, fee)
+
+		opts, err := p.txTemplate.Options(runID, "")
+
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, wallet.OptionFee(fee.String()))
+
+		trx, err := wlt.MakeTransferTx(accountAddress, p.destination, transferAmount, opts...)
+
+		if err != nil {
+			return fmt.Errorf("failed to make transfer transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return err
+		}
+
+		transferred += transferAmount
+	}
+
+	log.Printf("[account transfer] total transferred: %v", transferred)
+
+	return nil
+}
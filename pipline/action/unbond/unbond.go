@@ -0,0 +1,153 @@
+package unbond
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+)
+
+type UnbondAction struct {
+	validatorAddresses     []string
+	validatorWallets       *common.ValidatorWallets
+	filter                 *common.Filter
+	pipline                provider.PiplineProvider
+	txTemplate             *common.TxTemplate
+	availabilityScoreBelow float64
+}
+
+func CreateUnbondAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*UnbondAction, error) {
+	targets, err := common.LoadTargets(actionConfig.Targets, actionConfig.TargetsFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	validatorWallets, err := common.OpenValidatorWallets(pipline, actionConfig.ValidatorWallets)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := pipline.GetAddressLabels()
+
+	common.AddLabels(labels, targets)
+
+	filter, err := common.CreateFilter(actionConfig.Filter, labels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &UnbondAction{
+		validatorAddresses:     targets.Addresses,
+		validatorWallets:       validatorWallets,
+		filter:                 filter,
+		pipline:                pipline,
+		txTemplate:             txTemplate,
+		availabilityScoreBelow: actionConfig.Conditions.AvailabilityScoreBelow,
+	}
+
+	log.Printf("Pipline %s action %d has %d unbond targets", action.pipline.GetName(), index, len(action.validatorAddresses))
+
+	for i, address := range action.validatorAddresses {
+		wlt, _ := action.validatorWallets.Get(address)
+
+		if wlt == nil {
+			return nil, fmt.Errorf("no wallet holds the key of validator: %s", address)
+		}
+
+		amount, validatorInfo, err := action.pipline.GetValidatorStake(address)
+		if err != nil {
+			return nil, err
+		}
+
+		availabilityScore := 1.0
+
+		if validatorInfo != nil {
+			availabilityScore = validatorInfo.AvailabilityScore
+		}
+
+		log.Printf("%d - %s - stake: %s (score: %v)", i+1, address, amount.String(), availabilityScore)
+	}
+
+	return action, nil
+}
+
+func (p *UnbondAction) GetName() string {
+	return "unbond"
+}
+
+func (p *UnbondAction) GetValidatorAddresses() []string {
+	return p.validatorAddresses
+}
+
+func (p *UnbondAction) GetFilter() *common.Filter {
+	return p.filter
+}
+
+func (p *UnbondAction) Run(runID string) error {
+	for _, validatorAddress := range p.validatorAddresses {
+		if !p.filter.AllowValidator(validatorAddress) {
+			log.Printf("[validator unbond] validator=%v excluded", validatorAddress)
+			continue
+		}
+
+		stake, validatorInfo, err := p.pipline.GetValidatorStake(validatorAddress)
+
+		if err != nil {
+			return err
+		}
+
+		if validatorInfo == nil {
+			log.Printf("[validator unbond] validator=%v not found, skip", validatorAddress)
+			continue
+		}
+
+		if validatorInfo.UnbondingHeight != 0 {
+			log.Printf("[validator unbond] validator=%v already unbonded at height %v, skip", validatorAddress, validatorInfo.UnbondingHeight)
+			continue
+		}
+
+		if p.availabilityScoreBelow > 0 && validatorInfo.AvailabilityScore >= p.availabilityScoreBelow {
+			log.Printf("[validator unbond] validator=%v score=%v not below %v, skip", validatorAddress, validatorInfo.AvailabilityScore, p.availabilityScoreBelow)
+			continue
+		}
+
+		wlt, password := p.validatorWallets.Get(validatorAddress)
+
+		if wlt == nil {
+			return fmt.Errorf("failed to get wallet for validator: %s", validatorAddress)
+		}
+
+		log.Printf("[validator unbond] validator=%v stake=%v score=%v", validatorAddress, stake, validatorInfo.AvailabilityScore)
+
+		opts, err := p.txTemplate.Options(runID, validatorAddress)
+
+		if err != nil {
+			return err
+		}
+
+		trx, err := wlt.MakeUnbondTx(validatorAddress, opts...)
+
+		if err != nil {
+			return fmt.Errorf("failed to make unbond transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package withdraw
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/crypto"
+	"github.com/pactus-project/pactus/wallet"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+type WithdrawAction struct {
+	validatorAddresses []string
+	validatorWallets   *common.ValidatorWallets
+	filter             *common.Filter
+	pipline            provider.PiplineProvider
+	txTemplate         *common.TxTemplate
+	rewardAccount      string
+	fees               *common.FeePolicy
+	unbondInterval     uint32
+}
+
+func CreateWithdrawAction(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (*WithdrawAction, error) {
+	addr, err := crypto.AddressFromString(actionConfig.RewardAccount)
+
+	if err != nil || !addr.IsAccountAddress() {
+		return nil, fmt.Errorf("invalid reward account: %s", actionConfig.RewardAccount)
+	}
+
+	fees, err := common.CreateFeePolicy(pipline, optionsConfig, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := common.LoadTargets(actionConfig.Targets, actionConfig.TargetsFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	validatorWallets, err := common.OpenValidatorWallets(pipline, actionConfig.ValidatorWallets)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := pipline.GetAddressLabels()
+
+	common.AddLabels(labels, targets)
+
+	filter, err := common.CreateFilter(actionConfig.Filter, labels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	txTemplate, err := common.CreateTxTemplate(pipline, actionConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	action := &WithdrawAction{
+		validatorAddresses: targets.Addresses,
+		validatorWallets:   validatorWallets,
+		filter:             filter,
+		pipline:            pipline,
+		txTemplate:         txTemplate,
+		rewardAccount:      actionConfig.RewardAccount,
+		fees:               fees,
+		unbondInterval:     pipline.GetConsensusParams().UnbondInterval,
+	}
+
+	log.Printf("Pipline %s action %d has %d withdraw targets to %s", action.pipline.GetName(), index, len(action.validatorAddresses), action.rewardAccount)
+
+	for i, address := range action.validatorAddresses {
+		wlt, _ := action.validatorWallets.Get(address)
+
+		if wlt == nil {
+			return nil, fmt.Errorf("no wallet holds the key of validator: %s", address)
+		}
+
+		amount, validatorInfo, err := action.pipline.GetValidatorStake(address)
+		if err != nil {
+			return nil, err
+		}
+
+		unbondingHeight := uint32(0)
+
+		if validatorInfo != nil {
+			unbondingHeight = validatorInfo.UnbondingHeight
+		}
+
+		log.Printf("%d - %s - stake: %s (unbonding height: %v)", i+1, address, amount.String(), unbondingHeight)
+	}
+
+	return action, nil
+}
+
+func (p *WithdrawAction) GetName() string {
+	return "withdraw"
+}
+
+func (p *WithdrawAction) GetValidatorAddresses() []string {
+	return p.validatorAddresses
+}
+
+func (p *WithdrawAction) GetFilter() *common.Filter {
+	return p.filter
+}
+
+func (p *WithdrawAction) Run(runID string) error {
+	fee, err := p.fees.Fee(pactus.PayloadType_PAYLOAD_TYPE_WITHDRAW)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := p.pipline.GetBlockchainInfo()
+
+	if err != nil {
+		return fmt.Errorf("failed to get blockchain info: %w", err)
+	}
+
+	height := info.LastBlockHeight
+
+	for _, validatorAddress := range p.validatorAddresses {
+		if !p.filter.AllowValidator(validatorAddress) {
+			log.Printf("[validator withdraw] validator=%v excluded", validatorAddress)
+			continue
+		}
+
+		stake, validatorInfo, err := p.pipline.GetValidatorStake(validatorAddress)
+
+		if err != nil {
+			return err
+		}
+
+		if validatorInfo == nil || validatorInfo.UnbondingHeight == 0 {
+			log.Printf("[validator withdraw] validator=%v not unbonded, skip", validatorAddress)
+			continue
+		}
+
+		withdrawableHeight := validatorInfo.UnbondingHeight + p.unbondInterval
+
+		if height < withdrawableHeight {
+			log.Printf("[validator withdraw] validator=%v withdrawable at height %v (current %v), skip", validatorAddress, withdrawableHeight, height)
+			continue
+		}
+
+		if stake <= fee {
+			log.Printf("[validator withdraw] validator=%v stake=%v nothing to withdraw, skip", validatorAddress, stake)
+			continue
+		}
+
+		wlt, password := p.validatorWallets.Get(validatorAddress)
+
+		if wlt == nil {
+			return fmt.Errorf("failed to get wallet for validator: %s", validatorAddress)
+		}
+
+		withdrawAmount := stake - fee
+
+		log.Printf("[validator withdraw] validator=%v withdraw=%v fee=%v to=%v", validatorAddress, withdrawAmount, fee, p.rewardAccount)
+
+		opts, err := p.txTemplate.Options(runID, validatorAddress)
+
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, wallet.OptionFee(fee.String()))
+
+		trx, err := wlt.MakeWithdrawTx(validatorAddress, p.rewardAccount, withdrawAmount, opts...)
+
+		if err != nil {
+			return fmt.Errorf("failed to make withdraw transaction: %w", err)
+		}
+
+		_, err = common.SignAndBroadcast(p.pipline.GetContext(), wlt, password, trx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package pipline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/pactus-project/pactus/types/amount"
+)
+
+const defaultBalanceMinInterval = 24 * time.Hour
+
+// balanceTrigger fires an action once the reward accounts of the pipline hold
+// more than a threshold, at most once per minimum interval.
+type balanceTrigger struct {
+	threshold   amount.Amount
+	anyAccount  bool
+	minInterval time.Duration
+	// lastRun is the end of the last successful run of the action, whatever
+	// triggered it. It is kept in the state file, so a restart does not run
+	// it again early
+	lastRun time.Time
+	// failedAt is the end of the last failed or deferred run
+	failedAt time.Time
+}
+
+// createBalanceTrigger returns nil if the action has no when_balance_above trigger.
+func createBalanceTrigger(actionConfig *config.Action) (*balanceTrigger, error) {
+	if actionConfig.WhenBalanceAbove == 0 {
+		return nil, nil
+	}
+
+	threshold, err := amount.NewAmount(actionConfig.WhenBalanceAbove)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create balance threshold: %w", err)
+	}
+
+	trigger := &balanceTrigger{
+		threshold:   threshold,
+		minInterval: defaultBalanceMinInterval,
+	}
+
+	switch actionConfig.BalanceScope {
+	case "", "total":
+	case "account":
+		trigger.anyAccount = true
+	default:
+		return nil, fmt.Errorf("unknown balance scope: %s", actionConfig.BalanceScope)
+	}
+
+	if actionConfig.MinInterval != "" {
+		minInterval, err := time.ParseDuration(actionConfig.MinInterval)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid min interval %q: %w", actionConfig.MinInterval, err)
+		}
+
+		trigger.minInterval = minInterval
+	}
+
+	return trigger, nil
+}
+
+// waiting reports whether the minimum interval since the last successful run,
+// or the retry delay since the last failed run, has not passed yet.
+func (t *balanceTrigger) waiting(now time.Time, retryDelay time.Duration) bool {
+	if !t.lastRun.IsZero() && now.Sub(t.lastRun) < t.minInterval {
+		return true
+	}
+
+	return !t.failedAt.IsZero() && now.Sub(t.failedAt) < retryDelay
+}
+
+// crossed reports whether the balances of the accounts allowed by the filter
+// of the action are above the threshold, with the balance that was compared.
+func (t *balanceTrigger) crossed(addresses []string, amounts []amount.Amount, filter *common.Filter) (bool, amount.Amount) {
+	if t.anyAccount {
+		highest := amount.Amount(0)
+
+		for i, amt := range amounts {
+			if filter.AllowAccount(addresses[i]) && amt > highest {
+				highest = amt
+			}
+		}
+
+		return highest > t.threshold, highest
+	}
+
+	total := amount.Amount(0)
+
+	for i, amt := range amounts {
+		if filter.AllowAccount(addresses[i]) {
+			total += amt
+		}
+	}
+
+	return total > t.threshold, total
+}
+
+func (t *balanceTrigger) String() string {
+	scope := "total"
+
+	if t.anyAccount {
+		scope = "any account"
+	}
+
+	return fmt.Sprintf("%s balance above %s, at most every %s", scope, t.threshold, t.minInterval)
+}
@@ -0,0 +1,82 @@
+package pipline
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/crypto"
+	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
+)
+
+// ImportTargetsCsv checks a target list managed outside of this tool, fills the
+// missing public keys of validators that exist on chain and writes the result
+// to a file that can be used as the targets_file of an action.
+func ImportTargetsCsv(optionsConfig *config.Options, input, output string) error {
+	records, err := common.ReadTargetsCsv(input)
+	if err != nil {
+		return err
+	}
+
+	pip := newPipline(context.Background(), provider.SystemClock{}, "import")
+
+	err = pip.connect(optionsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to blockchain: %w", err)
+	}
+
+	nodeInfo, err := pip.networkClient.GetNodeInfo(pip.ctx, &pactus.GetNodeInfoRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to get node info: %w", err)
+	}
+
+	if nodeInfo.NetworkName != "pactus" {
+		crypto.ToTestnetHRP()
+	}
+
+	imported := make([]common.TargetRecord, 0, len(records))
+	processedAddresses := map[string]bool{}
+
+	for i, record := range records {
+		addr, err := crypto.AddressFromString(record.Address)
+
+		if err != nil || !addr.IsValidatorAddress() {
+			return fmt.Errorf("row %d: not a validator address: %s", i+1, record.Address)
+		}
+
+		if processedAddresses[record.Address] {
+			log.Printf("ignore duplicate target address: %s", record.Address)
+			continue
+		}
+
+		processedAddresses[record.Address] = true
+
+		if record.PublicKey != "" {
+			if err := common.CheckPublicKey(record.Address, record.PublicKey); err != nil {
+				return fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+
+		stake, validatorInfo, err := pip.GetValidatorStake(record.Address)
+		if err != nil {
+			return err
+		}
+
+		if validatorInfo != nil && record.PublicKey == "" {
+			record.PublicKey = validatorInfo.PublicKey
+		}
+
+		if validatorInfo == nil && record.PublicKey == "" {
+			log.Printf("%d - %s - not on chain and no public key, it can not be created by bond", i+1, record.Address)
+		} else {
+			log.Printf("%d - %s - stake: %s (label: %s, weight: %v)", i+1, record.Address, stake, record.Label, record.Weight)
+		}
+
+		imported = append(imported, record)
+	}
+
+	return common.WriteTargetsCsv(output, imported)
+}
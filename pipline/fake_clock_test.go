@@ -0,0 +1,103 @@
+package pipline
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when the test fires its next timer.
+type fakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	c := &fakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, &fakeWaiter{until: c.now.Add(d), ch: ch})
+	c.cond.Broadcast()
+
+	return ch
+}
+
+// jump steps the wall time like an NTP step or a suspend of the host. Pending
+// timers follow the monotonic clock, they fire after the same wait as before.
+func (c *fakeClock) jump(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for _, w := range c.waiters {
+		w.until = w.until.Add(d)
+	}
+}
+
+// blockUntil waits until n timers are pending.
+func (c *fakeClock) blockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// fireNext waits until n timers are pending, then moves the time to the
+// earliest one and fires it. It returns the new time.
+func (c *fakeClock) fireNext(n int) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+
+	next := 0
+
+	for i, w := range c.waiters {
+		if w.until.Before(c.waiters[next].until) {
+			next = i
+		}
+	}
+
+	w := c.waiters[next]
+	c.waiters = append(c.waiters[:next], c.waiters[next+1:]...)
+
+	if w.until.After(c.now) {
+		c.now = w.until
+	}
+
+	w.ch <- c.now
+
+	return c.now
+}
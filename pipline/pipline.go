@@ -6,10 +6,13 @@ import (
 	"log"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/frimin/pactus-staker/config"
 	"github.com/frimin/pactus-staker/pipline/action"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/genesis"
 	"github.com/pactus-project/pactus/types/amount"
 	"github.com/pactus-project/pactus/wallet"
 	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
@@ -22,14 +25,41 @@ type Pipline interface {
 }
 
 type pipline struct {
-	ctx              context.Context
-	name             string
-	actions          []action.Action
-	walletList       []*wallet.Wallet
-	walletPassword   []string
-	accountAddresses map[string]int
-
-	blockchainClient pactus.BlockchainClient
+	// mu keeps the actions of a pipline from running at the same time
+	mu sync.Mutex
+	// ctx is canceled when the process shuts down
+	ctx                context.Context
+	clock              provider.Clock
+	name               string
+	actions            []action.Action
+	walletList         []*wallet.Wallet
+	walletPassword     []string
+	accountAddresses   map[string]int
+	validatorAddresses map[string]int
+	// dependsOn holds, for each action, the indexes of the earlier actions
+	// whose last run must have succeeded before it runs
+	dependsOn     [][]int
+	lastSucceeded []bool
+	// summaries counts the runs of each action, logged on shutdown
+	summaries []runSummary
+	// schedules holds the parsed trigger times of each action
+	schedules [][]schedule
+	// locations is the time zone the schedules of each action are evaluated in
+	locations []*time.Location
+	// jitters is the window the scheduled runs of each action are randomly delayed in
+	jitters []time.Duration
+	// everyBlocks is the block interval of each action, 0 if not triggered by height
+	everyBlocks []uint32
+	// balanceTriggers is the when_balance_above trigger of each action, or nil
+	balanceTriggers []*balanceTrigger
+	// stateKeys identifies each action in options.state_file
+	stateKeys []string
+	// consensusParams is read once from the node, see loadConsensusParams
+	consensusParams *genesis.GenesisParams
+
+	blockchainClient  pactus.BlockchainClient
+	networkClient     pactus.NetworkClient
+	transactionClient pactus.TransactionClient
 }
 
 func (p *pipline) Run() error {
@@ -40,10 +70,34 @@ func (p *pipline) GetName() string {
 	return p.name
 }
 
+// GetContext returns the context of the process, it is canceled on shutdown.
+func (p *pipline) GetContext() context.Context {
+	return p.ctx
+}
+
+func (p *pipline) GetClock() provider.Clock {
+	return p.clock
+}
+
 func (p *pipline) GetActions() []action.Action {
 	return p.actions
 }
 
+// canRun reports whether every action the given action depends on has succeeded in its last run.
+func (p *pipline) canRun(actionIndex int) bool {
+	for _, dependency := range p.dependsOn[actionIndex] {
+		if !p.lastSucceeded[dependency] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *pipline) setResult(actionIndex int, err error) {
+	p.lastSucceeded[actionIndex] = err == nil
+}
+
 func (p *pipline) GetAllBalance() ([]string, []amount.Amount, error) {
 	addresses := make([]string, 0)
 	amounts := make([]amount.Amount, 0)
@@ -68,10 +122,87 @@ func (p *pipline) GetAccountWallet(address string) (*wallet.Wallet, string) {
 	return nil, ""
 }
 
+func (p *pipline) GetValidatorWallet(address string) (*wallet.Wallet, string) {
+	if i, ok := p.validatorAddresses[address]; ok {
+		return p.walletList[i], p.walletPassword[i]
+	}
+
+	return nil, ""
+}
+
+// GetAddressLabels returns the addresses of the pipline wallets by label.
+func (p *pipline) GetAddressLabels() map[string][]string {
+	labels := make(map[string][]string)
+
+	for _, wlt := range p.walletList {
+		for _, address := range wlt.ListAddresses() {
+			if address.Label != "" {
+				labels[address.Label] = append(labels[address.Label], address.Address)
+			}
+		}
+	}
+
+	return labels
+}
+
 func (p *pipline) GetBlockchainClient() pactus.BlockchainClient {
 	return p.blockchainClient
 }
 
+func (p *pipline) GetBlockchainInfo() (*pactus.GetBlockchainInfoResponse, error) {
+	return p.GetBlockchainClient().GetBlockchainInfo(p.ctx, &pactus.GetBlockchainInfoRequest{})
+}
+
+func (p *pipline) GetCommitteeInfo() (*pactus.GetCommitteeInfoResponse, error) {
+	return p.GetBlockchainClient().GetCommitteeInfo(p.ctx, &pactus.GetCommitteeInfoRequest{})
+}
+
+// CalculateFee returns the fee the node estimates for a transaction of the given
+// payload type. The estimate only depends on the transaction pool, not on the amount.
+func (p *pipline) CalculateFee(payloadType pactus.PayloadType) (amount.Amount, error) {
+	res, err := p.transactionClient.CalculateFee(p.ctx, &pactus.CalculateFeeRequest{PayloadType: payloadType})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate fee: %w", err)
+	}
+
+	return amount.Amount(res.Fee), nil
+}
+
+// GetConsensusParams returns the consensus parameters of the network the node
+// runs, loaded once when the pipline is created.
+func (p *pipline) GetConsensusParams() *genesis.GenesisParams {
+	return p.consensusParams
+}
+
+// loadConsensusParams reads the consensus parameters of the network the node
+// runs. The node does not expose them over gRPC, so they are taken from the
+// genesis of the network reported by the node. The stake limits are checked
+// against them, so an unknown network fails instead of guessing.
+func (p *pipline) loadConsensusParams() error {
+	resp, err := p.networkClient.GetNodeInfo(p.ctx, &pactus.GetNodeInfoRequest{})
+
+	if err != nil {
+		return fmt.Errorf("failed to get node info: %w", err)
+	}
+
+	switch resp.NetworkName {
+	case "pactus":
+		p.consensusParams = genesis.MainnetGenesis().Params()
+	case "pactus-testnet":
+		p.consensusParams = genesis.TestnetGenesis().Params()
+	case "pactus-localnet":
+		// a local network is made with the default parameters
+		p.consensusParams = genesis.DefaultGenesisParams()
+	default:
+		return fmt.Errorf("unknown network %q, its consensus parameters are not known", resp.NetworkName)
+	}
+
+	log.Printf("Network: %s", resp.NetworkName)
+
+	return nil
+}
+
 func (p *pipline) GetValidatorStake(address string) (amount.Amount, *pactus.ValidatorInfo, error) {
 	resp, err := p.GetBlockchainClient().GetValidator(p.ctx, &pactus.GetValidatorRequest{Address: address})
 
@@ -91,6 +222,31 @@ func (p *pipline) GetValidatorStake(address string) (amount.Amount, *pactus.Vali
 	return amount.Amount(resp.Validator.Stake), validatorInfo, nil
 }
 
+// GetTransaction returns the committed transaction with the given ID, or nil if it
+// is not in a block (yet).
+func (p *pipline) GetTransaction(id string) (*pactus.GetTransactionResponse, error) {
+	resp, err := p.transactionClient.GetTransaction(p.ctx, &pactus.GetTransactionRequest{Id: id})
+
+	if err != nil {
+		if strings.Contains(err.Error(), "transaction not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (p *pipline) GetTxPoolContent() ([]*pactus.TransactionInfo, error) {
+	resp, err := p.GetBlockchainClient().GetTxPoolContent(p.ctx, &pactus.GetTxPoolContentRequest{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Txs, nil
+}
+
 func (p *pipline) GetValidator(address string) (*pactus.GetValidatorResponse, error) {
 	return p.GetBlockchainClient().GetValidator(p.ctx, &pactus.GetValidatorRequest{Address: address})
 }
@@ -109,6 +265,8 @@ func (p *pipline) connect(optionsConfig *config.Options) error {
 	}
 
 	p.blockchainClient = pactus.NewBlockchainClient(conn)
+	p.networkClient = pactus.NewNetworkClient(conn)
+	p.transactionClient = pactus.NewTransactionClient(conn)
 
 	// Check if client is responding
 	_, err = p.blockchainClient.GetBlockchainInfo(p.ctx,
@@ -122,15 +280,25 @@ func (p *pipline) connect(optionsConfig *config.Options) error {
 	return nil
 }
 
-func createPipline(optionsConfig *config.Options, piplineConfig config.Pipline) (*pipline, error) {
-	pip := &pipline{
-		ctx:              context.Background(),
-		name:             piplineConfig.Name,
-		actions:          make([]action.Action, 0),
-		walletList:       make([]*wallet.Wallet, 0),
-		walletPassword:   make([]string, 0),
-		accountAddresses: make(map[string]int),
+// actionFactory creates the action of an action config, it is action.CreateAction
+// outside of tests.
+type actionFactory func(pipline provider.PiplineProvider, index int, optionsConfig *config.Options, actionConfig *config.Action) (action.Action, error)
+
+func newPipline(ctx context.Context, clock provider.Clock, name string) *pipline {
+	return &pipline{
+		ctx:                ctx,
+		clock:              clock,
+		name:               name,
+		actions:            make([]action.Action, 0),
+		walletList:         make([]*wallet.Wallet, 0),
+		walletPassword:     make([]string, 0),
+		accountAddresses:   make(map[string]int),
+		validatorAddresses: make(map[string]int),
 	}
+}
+
+func createPipline(ctx context.Context, clock provider.Clock, optionsConfig *config.Options, piplineConfig config.Pipline) (*pipline, error) {
+	pip := newPipline(ctx, clock, piplineConfig.Name)
 
 	err := pip.connect(optionsConfig)
 
@@ -138,8 +306,16 @@ func createPipline(optionsConfig *config.Options, piplineConfig config.Pipline)
 		return nil, fmt.Errorf("failed to connect to blockchain: %w", err)
 	}
 
+	err = pip.loadConsensusParams()
+
+	if err != nil {
+		return nil, err
+	}
+
 	for _, rewardWallet := range piplineConfig.Reward.Wallets {
-		wlt, err := wallet.Open(pip.ctx, rewardWallet.Path)
+		// the wallet broadcasts the transactions, a signed transaction is
+		// still sent when the process is shutting down
+		wlt, err := wallet.Open(context.WithoutCancel(pip.ctx), rewardWallet.Path)
 
 		if err != nil {
 			return nil, fmt.Errorf("failed to open wallet: %w", err)
@@ -153,6 +329,10 @@ func createPipline(optionsConfig *config.Options, piplineConfig config.Pipline)
 		for _, address := range wlt.ListAddresses(wallet.OnlyAccountAddresses()) {
 			pip.accountAddresses[address.Address] = i
 		}
+
+		for _, address := range wlt.ListAddresses(wallet.OnlyValidatorAddresses()) {
+			pip.validatorAddresses[address.Address] = i
+		}
 	}
 
 	log.Printf("Pipline %s has %d wallets", piplineConfig.Name, len(pip.walletList))
@@ -173,19 +353,130 @@ func createPipline(optionsConfig *config.Options, piplineConfig config.Pipline)
 
 	log.Printf("Total balance: %s", totalAmount.String())
 
+	err = pip.createActions(optionsConfig, piplineConfig, action.CreateAction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pip, nil
+}
+
+// createActions parses the triggers and dependencies of the actions of the
+// pipline config and creates the actions with the factory.
+func (p *pipline) createActions(optionsConfig *config.Options, piplineConfig config.Pipline, createAction actionFactory) error {
+	actionIndexes := make(map[string]int)
+	nameCounts := make(map[string]int)
+
 	for i, actionConfig := range piplineConfig.Actions {
-		action, err := action.CreateAction(pip, i, optionsConfig, &actionConfig)
+		name := actionConfig.Name
+
+		if name == "" {
+			name = actionConfig.Type
+		}
+
+		nameCounts[name]++
+
+		// the state key is the name, numbered from the second action with
+		// the same name
+		stateKey := name
+
+		if nameCounts[name] > 1 {
+			stateKey = fmt.Sprintf("%s#%d", name, nameCounts[name])
+		}
+
+		p.stateKeys = append(p.stateKeys, stateKey)
+
+		dependsOn := make([]int, 0, len(actionConfig.DependsOn))
+
+		for _, dependency := range actionConfig.DependsOn {
+			j, ok := actionIndexes[dependency]
+
+			if !ok {
+				return fmt.Errorf("action %d %s depends on %s, which is not an earlier action", i, name, dependency)
+			}
+
+			dependsOn = append(dependsOn, j)
+		}
+
+		// a later action with the same name shadows the earlier one
+		actionIndexes[name] = i
+
+		p.dependsOn = append(p.dependsOn, dependsOn)
+		p.lastSucceeded = append(p.lastSucceeded, false)
+		p.summaries = append(p.summaries, runSummary{})
+
+		location, err := loadLocation(optionsConfig.Timezone, actionConfig.Timezone)
+
+		if err != nil {
+			return fmt.Errorf("action %d %s: %w", i, name, err)
+		}
+
+		p.locations = append(p.locations, location)
+
+		schedules := make([]schedule, 0, len(actionConfig.Time))
+
+		for _, spec := range actionConfig.Time {
+			sched, err := parseSchedule(spec)
+
+			if err != nil {
+				return fmt.Errorf("action %d %s: %w", i, name, err)
+			}
+
+			if sched.next(p.clock.Now()).IsZero() {
+				return fmt.Errorf("action %d %s: time %q never triggers", i, name, spec)
+			}
+
+			schedules = append(schedules, sched)
+		}
+
+		if actionConfig.Every != "" {
+			sched, err := parseInterval(actionConfig.Every)
+
+			if err != nil {
+				return fmt.Errorf("action %d %s: %w", i, name, err)
+			}
+
+			schedules = append(schedules, sched)
+		}
+
+		p.schedules = append(p.schedules, schedules)
+
+		jitter := time.Duration(0)
+
+		if actionConfig.Jitter != "" {
+			jitter, err = time.ParseDuration(actionConfig.Jitter)
+
+			if err != nil || jitter < 0 {
+				return fmt.Errorf("action %d %s: invalid jitter %q", i, name, actionConfig.Jitter)
+			}
+		}
+
+		p.jitters = append(p.jitters, jitter)
+		p.everyBlocks = append(p.everyBlocks, actionConfig.EveryBlocks)
+
+		balanceTrigger, err := createBalanceTrigger(&actionConfig)
 
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("action %d %s: %w", i, name, err)
 		}
 
-		pip.actions = append(pip.actions, action)
+		p.balanceTriggers = append(p.balanceTriggers, balanceTrigger)
+
+		actionConfig.Filter = piplineConfig.Filter.Merge(actionConfig.Filter)
+
+		action, err := createAction(p, i, optionsConfig, &actionConfig)
+
+		if err != nil {
+			return err
+		}
+
+		p.actions = append(p.actions, action)
 	}
 
-	if len(pip.actions) != 1 {
-		return nil, fmt.Errorf("limit to one action per pipline")
+	if len(p.actions) == 0 {
+		return fmt.Errorf("no actions found in pipline %s", p.name)
 	}
 
-	return pip, nil
+	return nil
 }
@@ -1,23 +1,37 @@
 package pipline
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/frimin/pactus-staker/config"
 	"github.com/frimin/pactus-staker/pipline/action"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+	"github.com/pactus-project/pactus/types/amount"
 )
 
 type PiplineExecutor interface {
-	Run() error
+	Run(ctx context.Context) error
 	ExportValidatorsCsv(filename string) error
 }
 
 type piplineExecutor struct {
+	clock    provider.Clock
 	piplines []*pipline
 	retry    []int
+	// state is nil if options.state_file is not set
+	state         *runState
+	stateLock     sync.Mutex
+	catchUpWindow time.Duration
+	// slots limits the number of actions running at the same time
+	slots chan struct{}
 }
 
 type pendingAction struct {
@@ -25,77 +39,261 @@ type pendingAction struct {
 	actionIndex  int
 	pipline      *pipline
 	action       action.Action
+	schedule     schedule
 	triggerTime  time.Time
+	// jitter delays the run after the trigger time, see withJitter
+	jitter time.Duration
+	// everyBlocks and triggerHeight are set instead of schedule and
+	// triggerTime for actions triggered by block height
+	everyBlocks   uint32
+	triggerHeight uint32
+	// balance is set for actions triggered by the balance of the reward accounts
+	balance *balanceTrigger
+	// catchUp is set for a trigger missed while the process was down, it is
+	// not rescheduled as the schedule already has its next trigger pending
+	catchUp bool
+	// resumeAt is set for the next run of a run that deferred part of its
+	// work, it keeps the run ID of the deferred run and is not rescheduled
+	resumeAt time.Time
 }
 
-func CreateExecutor(config *config.Config) (PiplineExecutor, error) {
-	pipExecutor := &piplineExecutor{
-		piplines: []*pipline{},
-		retry:    make([]int, len(config.Options.RetryDelay)),
+// runID identifies a triggered run of an action, retries share the same run ID.
+func (a *pendingAction) runID() string {
+	if a.everyBlocks != 0 {
+		return fmt.Sprintf("h%d-%d-%d", a.triggerHeight, a.piplineIndex, a.actionIndex)
 	}
 
-	if len(config.Options.RetryDelay) == 0 {
-		log.Fatalf("no retry delay found")
+	return fmt.Sprintf("%s-%d-%d", a.triggerTime.Format("20060102T1504"), a.piplineIndex, a.actionIndex)
+}
+
+func (a *pendingAction) trigger() string {
+	if !a.resumeAt.IsZero() {
+		return fmt.Sprintf("%s (resume of run %s)", formatTime(a.resumeAt), a.runID())
+	}
+
+	if a.balance != nil {
+		return a.balance.String()
+	}
+
+	if a.everyBlocks != 0 {
+		return fmt.Sprintf("height %d (every %d blocks)", a.triggerHeight, a.everyBlocks)
+	}
+
+	if a.jitter > 0 {
+		return fmt.Sprintf("%s (%s, jitter +%s)", formatTime(a.runAt()), a.schedule, a.jitter)
+	}
+
+	return fmt.Sprintf("%s (%s)", formatTime(a.triggerTime), a.schedule)
+}
+
+// runAt is the time the action runs, the trigger time delayed by the jitter.
+func (a *pendingAction) runAt() time.Time {
+	if !a.resumeAt.IsZero() {
+		return a.resumeAt
+	}
+
+	return a.triggerTime.Add(a.jitter)
+}
+
+// withJitter picks the jitter of a scheduled trigger inside the jitter window of
+// the action. It is derived from the pipline name and the trigger time, so the
+// same run always gets the same offset, and the actions of a pipline triggered
+// at the same time with the same window get the same offset and still run in
+// the declared order.
+func (a *pendingAction) withJitter() *pendingAction {
+	window := a.pipline.jitters[a.actionIndex]
+
+	if window < time.Second {
+		return a
 	}
 
-	copy(pipExecutor.retry[:], config.Options.RetryDelay[:])
+	h := fnv.New64a()
+	h.Write([]byte(a.pipline.name + "/" + a.triggerTime.UTC().Format(time.RFC3339)))
+
+	a.jitter = time.Duration(h.Sum64()%uint64(window/time.Second)) * time.Second
+
+	return a
+}
+
+// formatTime shows a time in its time zone and in UTC.
+func formatTime(t time.Time) string {
+	return fmt.Sprintf("%s (%s) / %s UTC", t.Format("2006-01-02 15:04 MST"), t.Location(), t.UTC().Format("2006-01-02 15:04"))
+}
+
+// runSummary counts the runs of an action since the process started.
+type runSummary struct {
+	succeeded int
+	failed    int
+	skipped   int
+	// deferred runs left part of their work to a later run
+	deferred int
+	// interrupted runs failed because the process is shutting down
+	interrupted int
+	lastRunID   string
+}
+
+// CreateExecutor creates the piplines of the config. The context is passed to
+// the piplines and their actions, canceling it shuts them down. The clock is
+// the time source of the scheduler, use SystemClock outside of tests.
+func CreateExecutor(ctx context.Context, config *config.Config, clock provider.Clock) (PiplineExecutor, error) {
+	piplines := []*pipline{}
 
 	for _, p := range config.Pipeline {
-		p, err := createPipline(config.Options, p)
+		p, err := createPipline(ctx, clock, config.Options, p)
 
 		if err != nil {
 			return nil, fmt.Errorf("error creating pipline: %w", err)
 		}
 
-		pipExecutor.piplines = append(pipExecutor.piplines, p)
+		piplines = append(piplines, p)
+	}
+
+	return newExecutor(config.Options, piplines, clock)
+}
+
+// newExecutor schedules the given piplines with the options of the config.
+func newExecutor(optionsConfig *config.Options, piplines []*pipline, clock provider.Clock) (*piplineExecutor, error) {
+	pipExecutor := &piplineExecutor{
+		clock:    clock,
+		piplines: piplines,
+		retry:    make([]int, len(optionsConfig.RetryDelay)),
+	}
+
+	if len(optionsConfig.RetryDelay) == 0 {
+		log.Fatalf("no retry delay found")
+	}
+
+	copy(pipExecutor.retry[:], optionsConfig.RetryDelay[:])
+
+	if optionsConfig.StateFile != "" {
+		state, err := loadRunState(optionsConfig.StateFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipExecutor.state = state
+	}
+
+	if optionsConfig.CatchUpWindow != "" {
+		if optionsConfig.StateFile == "" {
+			return nil, fmt.Errorf("catch_up_window requires state_file")
+		}
+
+		window, err := time.ParseDuration(optionsConfig.CatchUpWindow)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid catch up window %q: %w", optionsConfig.CatchUpWindow, err)
+		}
+
+		pipExecutor.catchUpWindow = window
 	}
 
 	if len(pipExecutor.piplines) == 0 {
 		return nil, fmt.Errorf("no piplines found")
 	}
 
+	maxConcurrent := optionsConfig.MaxConcurrent
+
+	if maxConcurrent <= 0 {
+		maxConcurrent = len(pipExecutor.piplines)
+	}
+
+	pipExecutor.slots = make(chan struct{}, maxConcurrent)
+
 	return pipExecutor, nil
 }
 
-func getTimeFromHHMM(now time.Time, hhmm string) (time.Time, error) {
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+// makePendingActions returns the next trigger of every schedule of every action
+// after now, sorted by trigger time.
+func (p *piplineExecutor) makePendingActions(now time.Time) []*pendingAction {
+	actions := []*pendingAction{}
 
-	t, err := time.Parse("15:04", hhmm)
-	if err != nil {
-		return time.Time{}, err
+	for piplineIndex, pipline := range p.piplines {
+		for actionIndex, action := range pipline.actions {
+			location := pipline.locations[actionIndex]
+
+			for _, sched := range pipline.schedules[actionIndex] {
+				pending := &pendingAction{
+					piplineIndex: piplineIndex,
+					actionIndex:  actionIndex,
+					pipline:      pipline,
+					action:       action,
+					schedule:     sched,
+					triggerTime:  sched.next(now.In(location)),
+				}
+
+				actions = append(actions, pending.withJitter())
+			}
+		}
 	}
 
-	return today.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute), nil
+	sortPendingActions(actions)
+
+	return actions
 }
 
-func (p *piplineExecutor) makePendingActions(now time.Time) []*pendingAction {
+// makeCatchUpActions returns, for each scheduled action, the latest trigger
+// within the catch up window that was missed since its last successful run.
+// Actions that never ran successfully are not caught up.
+func (p *piplineExecutor) makeCatchUpActions(now time.Time) []*pendingAction {
 	actions := []*pendingAction{}
 
+	if p.state == nil || p.catchUpWindow == 0 {
+		return actions
+	}
+
 	for piplineIndex, pipline := range p.piplines {
 		for actionIndex, action := range pipline.actions {
-			for _, triggerTime := range action.GetTime() {
-				t, err := getTimeFromHHMM(now, triggerTime)
+			last, ok := p.state.LastRuns[pipline.runStateKey(actionIndex)]
 
-				if err != nil {
-					log.Fatalf("error parsing time: %v", err)
-				}
+			if !ok {
+				continue
+			}
+
+			since := now.Add(-p.catchUpWindow)
 
-				if t.After(now) {
-					actions = append(actions, &pendingAction{
-						piplineIndex: piplineIndex,
-						actionIndex:  actionIndex,
-						pipline:      pipline,
-						action:       action,
-						triggerTime:  t,
-					})
+			if last.TriggerTime.After(since) {
+				since = last.TriggerTime
+			}
+
+			var missed *pendingAction
+
+			for _, sched := range pipline.schedules[actionIndex] {
+				t := sched.next(since.In(pipline.locations[actionIndex]))
+
+				for !t.IsZero() && !t.After(now) {
+					if missed == nil || t.After(missed.triggerTime) {
+						missed = &pendingAction{
+							piplineIndex: piplineIndex,
+							actionIndex:  actionIndex,
+							pipline:      pipline,
+							action:       action,
+							schedule:     sched,
+							triggerTime:  t,
+							catchUp:      true,
+						}
+					}
+
+					t = sched.next(t)
 				}
 			}
+
+			if missed != nil {
+				log.Printf("[pipline %d %s action %d %s] missed run at %s, last run at %s, catch up now", piplineIndex, pipline.name, actionIndex, action.GetName(), formatTime(missed.triggerTime), formatTime(last.TriggerTime))
+
+				actions = append(actions, missed)
+			}
 		}
 	}
 
+	return actions
+}
+
+func sortPendingActions(actions []*pendingAction) {
 	sort.Slice(actions, func(i, j int) bool {
-		if !actions[i].triggerTime.Equal(actions[j].triggerTime) {
-			return actions[i].triggerTime.Before(actions[j].triggerTime)
+		if !actions[i].runAt().Equal(actions[j].runAt()) {
+			return actions[i].runAt().Before(actions[j].runAt())
 		}
 
 		if actions[i].piplineIndex != actions[j].piplineIndex {
@@ -104,81 +302,528 @@ func (p *piplineExecutor) makePendingActions(now time.Time) []*pendingAction {
 
 		return actions[i].actionIndex < actions[j].actionIndex
 	})
+}
+
+// reschedule adds the next trigger of the schedule of a triggered action.
+func (p *piplineExecutor) reschedule(actions []*pendingAction, triggered *pendingAction, now time.Time) []*pendingAction {
+	next := *triggered
+	next.triggerTime = triggered.schedule.next(now.In(triggered.triggerTime.Location()))
+
+	if next.triggerTime.IsZero() {
+		log.Printf("[pipline %d %s action %d %s] %s does not trigger again", next.piplineIndex, next.pipline.name, next.actionIndex, next.action.GetName(), next.schedule)
+		return actions
+	}
+
+	next.withJitter()
+
+	next.logWaiting()
+
+	actions = append(actions, &next)
+	sortPendingActions(actions)
 
 	return actions
 }
 
-func (p *piplineExecutor) GetNextActions(lastTime time.Time) []*pendingAction {
-	actions := p.makePendingActions(lastTime)
+func (a *pendingAction) logWaiting() {
+	log.Printf("[pipline %d %s action %d %s] Waiting at %s", a.piplineIndex, a.pipline.name, a.actionIndex, a.action.GetName(), a.trigger())
+}
 
-	if len(actions) == 0 {
-		// is no action pending, try get next day
-		nextDay := lastTime.AddDate(0, 0, 1)
-		nextDayStart := time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 0, nextDay.Location())
-		actions = p.makePendingActions(nextDayStart)
+// makeBlockActions returns the actions triggered by block height, with the next
+// multiple of their block interval as trigger height.
+func (p *piplineExecutor) makeBlockActions() ([]*pendingAction, error) {
+	actions := []*pendingAction{}
+
+	for piplineIndex, pipline := range p.piplines {
+		for actionIndex, action := range pipline.actions {
+			everyBlocks := pipline.everyBlocks[actionIndex]
+
+			if everyBlocks == 0 {
+				continue
+			}
+
+			info, err := pipline.GetBlockchainInfo()
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to get blockchain info: %w", err)
+			}
 
-		if len(actions) == 0 {
-			log.Fatalf("no actions found")
+			actions = append(actions, &pendingAction{
+				piplineIndex:  piplineIndex,
+				actionIndex:   actionIndex,
+				pipline:       pipline,
+				action:        action,
+				everyBlocks:   everyBlocks,
+				triggerHeight: nextBlockTrigger(info.LastBlockHeight, everyBlocks),
+			})
 		}
 	}
 
+	return actions, nil
+}
+
+// dueBlockActions returns the block triggered actions whose trigger height is
+// reached and moves their trigger height to the next multiple of their interval.
+func (p *piplineExecutor) dueBlockActions(actions []*pendingAction) []*pendingAction {
+	due := []*pendingAction{}
+	heights := make(map[*pipline]uint32)
+
 	for _, action := range actions {
-		log.Printf("[pipline %d %s action %d %s] Waiting at %s", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), action.triggerTime)
+		height, ok := heights[action.pipline]
+
+		if !ok {
+			info, err := action.pipline.GetBlockchainInfo()
+
+			if err != nil {
+				log.Printf("[pipline %d %s] failed to get blockchain info: %v", action.piplineIndex, action.pipline.name, err)
+				continue
+			}
+
+			height = info.LastBlockHeight
+			heights[action.pipline] = height
+		}
+
+		if height < action.triggerHeight {
+			continue
+		}
+
+		triggered := *action
+		due = append(due, &triggered)
+
+		action.triggerHeight = nextBlockTrigger(height, action.everyBlocks)
+		action.logWaiting()
+	}
+
+	return due
+}
+
+// makeBalanceActions returns the actions triggered by the balance of the reward
+// accounts, with the time of their last run read from the state file.
+func (p *piplineExecutor) makeBalanceActions() []*pendingAction {
+	actions := []*pendingAction{}
+
+	for piplineIndex, pipline := range p.piplines {
+		for actionIndex, action := range pipline.actions {
+			if pipline.balanceTriggers[actionIndex] == nil {
+				continue
+			}
+
+			if p.state != nil {
+				if lastRun, ok := p.state.BalanceRuns[pipline.runStateKey(actionIndex)]; ok {
+					pipline.balanceTriggers[actionIndex].lastRun = lastRun
+				}
+			}
+
+			actions = append(actions, &pendingAction{
+				piplineIndex: piplineIndex,
+				actionIndex:  actionIndex,
+				pipline:      pipline,
+				action:       action,
+				balance:      pipline.balanceTriggers[actionIndex],
+			})
+		}
 	}
 
 	return actions
 }
 
-func (p *piplineExecutor) Run() error {
-	pendingActions := p.GetNextActions(time.Now())
+// dueBalanceActions returns the balance triggered actions whose threshold is
+// crossed and whose minimum interval since the last run has passed.
+func (p *piplineExecutor) dueBalanceActions(actions []*pendingAction, now time.Time) []*pendingAction {
+	due := []*pendingAction{}
+	addresses := make(map[*pipline][]string)
+	balances := make(map[*pipline][]amount.Amount)
 
-	for {
-		if len(pendingActions) == 0 {
-			pendingActions = p.GetNextActions(time.Now())
+	for _, action := range actions {
+		if action.balance.waiting(now, time.Duration(p.retry[len(p.retry)-1])*time.Second) {
+			continue
 		}
 
-		if time.Now().After(pendingActions[0].triggerTime) {
+		amounts, ok := balances[action.pipline]
+
+		if !ok {
+			all, amts, err := action.pipline.GetAllBalance()
+
+			if err != nil {
+				log.Printf("[pipline %d %s] failed to get all balances: %v", action.piplineIndex, action.pipline.name, err)
+				continue
+			}
+
+			amounts = amts
+			addresses[action.pipline] = all
+			balances[action.pipline] = amounts
+		}
+
+		crossed, balance := action.balance.crossed(addresses[action.pipline], amounts, action.action.GetFilter())
+
+		if !crossed {
+			continue
+		}
+
+		log.Printf("[pipline %d %s action %d %s] balance %s crossed the threshold", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), balance)
+
+		// the minimum interval starts once a run succeeds, see saveBalanceRun
+		triggered := *action
+		triggered.triggerTime = now
+		due = append(due, &triggered)
+	}
+
+	return due
+}
+
+func (p *piplineExecutor) Run(ctx context.Context) error {
+	pendingActions := p.makePendingActions(p.clock.Now())
+	catchUpActions := p.makeCatchUpActions(p.clock.Now())
+
+	blockActions, err := p.makeBlockActions()
+
+	if err != nil {
+		return err
+	}
+
+	balanceActions := p.makeBalanceActions()
+
+	if len(pendingActions) == 0 && len(blockActions) == 0 && len(balanceActions) == 0 {
+		return fmt.Errorf("no actions found")
+	}
+
+	for _, action := range pendingActions {
+		action.logWaiting()
+	}
+
+	for _, action := range blockActions {
+		action.logWaiting()
+	}
+
+	for _, action := range balanceActions {
+		action.logWaiting()
+	}
+
+	pendingActions = append(catchUpActions, pendingActions...)
+	sortPendingActions(pendingActions)
+
+	// each pipline is scheduled by its own goroutine, so a pipline waiting
+	// for retries does not delay the others
+	var wg sync.WaitGroup
+
+	for piplineIndex := range p.piplines {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			p.runPipline(ctx,
+				piplineActions(pendingActions, piplineIndex),
+				piplineActions(blockActions, piplineIndex),
+				piplineActions(balanceActions, piplineIndex))
+		}()
+	}
+
+	wg.Wait()
+
+	p.logSummary()
+
+	return ctx.Err()
+}
+
+// logSummary logs the runs of every action, it is written when the executor
+// stops. The piplines are not running anymore, so no lock is taken.
+func (p *piplineExecutor) logSummary() {
+	log.Printf("Summary of the runs since start:")
+
+	for piplineIndex, pipline := range p.piplines {
+		for actionIndex, action := range pipline.actions {
+			summary := pipline.summaries[actionIndex]
+
+			log.Printf("[pipline %d %s action %d %s] succeeded=%d failed=%d skipped=%d deferred=%d interrupted=%d last_run=%s",
+				piplineIndex, pipline.name, actionIndex, action.GetName(),
+				summary.succeeded, summary.failed, summary.skipped, summary.deferred, summary.interrupted, summary.lastRunID)
+		}
+	}
+}
+
+// piplineActions returns the actions of one pipline.
+func piplineActions(actions []*pendingAction, piplineIndex int) []*pendingAction {
+	result := []*pendingAction{}
+
+	for _, action := range actions {
+		if action.piplineIndex == piplineIndex {
+			result = append(result, action)
+		}
+	}
+
+	return result
+}
+
+// pollInterval is how often the block height and balance triggers are checked.
+const pollInterval = 10 * time.Second
+
+// maxScheduleWait caps the wait for the next scheduled trigger. Timers follow
+// the monotonic clock, so after a step of the wall clock or a suspend of the
+// host a long timer would fire late, the wall time is checked again instead.
+const maxScheduleWait = time.Minute
+
+func (p *piplineExecutor) runPipline(ctx context.Context, pendingActions, blockActions, balanceActions []*pendingAction) {
+	if len(pendingActions) == 0 && len(blockActions) == 0 && len(balanceActions) == 0 {
+		return
+	}
+
+	for {
+		now := p.clock.Now()
+
+		if len(pendingActions) > 0 && !now.Before(pendingActions[0].runAt()) {
 			action := pendingActions[0]
 
-			retry := make([]int, len(p.retry))
+			if action.catchUp || !action.resumeAt.IsZero() {
+				pendingActions = pendingActions[1:]
+			} else {
+				pendingActions = p.reschedule(pendingActions[1:], action, now)
+			}
 
-			copy(retry[:], p.retry[:])
+			pendingActions = p.addResume(pendingActions, p.runAction(ctx, action))
+			continue
+		}
 
-			log.Printf("[pipline %d %s action %d %s] Running at %s", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), action.triggerTime)
+		var due []*pendingAction
 
-			err := action.action.Run()
+		if len(blockActions) > 0 {
+			due = append(due, p.dueBlockActions(blockActions)...)
+		}
 
-			for {
-				if err != nil {
-					if len(retry) > 0 {
-						log.Printf("Error running action: %v, retry later ...", err)
-					} else {
-						log.Printf("Error running action: %v, no retry left", err)
-					}
-				} else {
-					break
-				}
+		if len(balanceActions) > 0 {
+			due = append(due, p.dueBalanceActions(balanceActions, now)...)
+		}
 
-				if len(retry) > 0 {
-					time.Sleep(time.Duration(retry[0]) * time.Second)
-					retry = retry[1:]
-					err = action.action.Run()
-				} else {
-					break
-				}
+		for _, action := range due {
+			pendingActions = p.addResume(pendingActions, p.runAction(ctx, action))
+		}
+
+		// wake up at the next scheduled trigger, or to poll the block
+		// height and balance triggers
+		var scheduled, poll <-chan time.Time
+
+		if len(pendingActions) > 0 {
+			scheduled = p.clock.After(min(pendingActions[0].runAt().Sub(p.clock.Now()), maxScheduleWait))
+		}
+
+		if len(blockActions) > 0 || len(balanceActions) > 0 {
+			poll = p.clock.After(pollInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-scheduled:
+		case <-poll:
+		}
+	}
+}
+
+// addResume adds the next run of a deferred run to the pending actions.
+func (p *piplineExecutor) addResume(actions []*pendingAction, resume *pendingAction) []*pendingAction {
+	if resume == nil {
+		return actions
+	}
+
+	resume.logWaiting()
+
+	actions = append(actions, resume)
+	sortPendingActions(actions)
+
+	return actions
+}
+
+// sleep waits for the given duration, it returns false if the context is canceled first.
+func (p *piplineExecutor) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-p.clock.After(d):
+		return true
+	}
+}
+
+// runAction runs the action with its retries. If the run deferred part of its
+// work, it returns the next run of the action.
+func (p *piplineExecutor) runAction(ctx context.Context, action *pendingAction) *pendingAction {
+	// the global concurrency limit
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return nil
+	}
+
+	action.pipline.mu.Lock()
+	defer action.pipline.mu.Unlock()
+
+	// the process may have started shutting down while waiting for the lock
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	summary := &action.pipline.summaries[action.actionIndex]
+
+	retry := make([]int, len(p.retry))
+
+	copy(retry[:], p.retry[:])
+
+	if !action.pipline.canRun(action.actionIndex) {
+		log.Printf("[pipline %d %s action %d %s] skipped, a dependency did not succeed", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName())
+
+		action.pipline.setResult(action.actionIndex, fmt.Errorf("dependency not succeeded"))
+		summary.skipped++
+		return nil
+	}
+
+	runID := action.runID()
+	summary.lastRunID = runID
+
+	log.Printf("[pipline %d %s action %d %s] Running at %s (run %s)", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), action.trigger(), runID)
+
+	err := action.action.Run(runID)
+
+	var deferred *common.DeferredError
+	var unconfirmed *common.UnconfirmedError
+
+	for {
+		// a deferred run is not a failure, the rest runs later
+		if errors.As(err, &deferred) {
+			break
+		}
+
+		// its transactions may still be included, a retry could send them twice
+		if errors.As(err, &unconfirmed) {
+			log.Printf("Error running action: %v, not retried as the transactions may still be included", err)
+			break
+		}
+
+		if err != nil {
+			// no retry once the process is shutting down
+			if ctx.Err() != nil {
+				break
 			}
 
-			if err == nil {
-				log.Printf("[pipline %d %s action %d %s] done", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName())
+			if len(retry) > 0 {
+				log.Printf("Error running action: %v, retry later ...", err)
 			} else {
-				log.Printf("[pipline %d %s action %d %s] failed: %v", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), err)
+				log.Printf("Error running action: %v, no retry left", err)
 			}
+		} else {
+			break
+		}
 
-			pendingActions = pendingActions[1:]
-
-			time.Sleep(1 * time.Second)
+		if len(retry) > 0 {
+			if !p.sleep(ctx, time.Duration(retry[0])*time.Second) {
+				err = fmt.Errorf("retry canceled: %w", err)
+				break
+			}
+			retry = retry[1:]
+			err = action.action.Run(runID)
 		} else {
-			time.Sleep(10 * time.Second)
+			break
+		}
+	}
+
+	p.saveBalanceRun(ctx, action, err)
+
+	if deferred != nil {
+		// what was done succeeded, the actions depending on it can run
+		action.pipline.setResult(action.actionIndex, nil)
+		summary.deferred++
+
+		if action.schedule != nil {
+			p.saveLastRun(action, runID)
 		}
+
+		log.Printf("[pipline %d %s action %d %s] deferred: %v", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), err)
+
+		resume := *action
+		resume.resumeAt = p.clock.Now().Add(deferred.RetryAfter)
+
+		return &resume
+	}
+
+	action.pipline.setResult(action.actionIndex, err)
+
+	switch {
+	case err == nil:
+		summary.succeeded++
+	case ctx.Err() != nil:
+		summary.interrupted++
+	default:
+		summary.failed++
+	}
+
+	if err == nil && action.schedule != nil {
+		p.saveLastRun(action, runID)
+	}
+
+	if err == nil {
+		log.Printf("[pipline %d %s action %d %s] done", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName())
+	} else if ctx.Err() != nil {
+		log.Printf("[pipline %d %s action %d %s] interrupted by shutdown: %v", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), err)
+	} else {
+		log.Printf("[pipline %d %s action %d %s] failed: %v", action.piplineIndex, action.pipline.name, action.actionIndex, action.action.GetName(), err)
+	}
+
+	return nil
+}
+
+// saveBalanceRun starts the minimum interval of the balance trigger of an
+// action after a successful run, whatever triggered the run, so a scheduled
+// run also holds back the balance trigger. A run whose transactions may still
+// be included counts as successful, the balance does not show them yet. After
+// another failure the trigger only waits for the last retry delay.
+func (p *piplineExecutor) saveBalanceRun(ctx context.Context, action *pendingAction, runErr error) {
+	trigger := action.pipline.balanceTriggers[action.actionIndex]
+
+	if trigger == nil || ctx.Err() != nil {
+		return
+	}
+
+	var unconfirmed *common.UnconfirmedError
+
+	if runErr != nil && !errors.As(runErr, &unconfirmed) {
+		trigger.failedAt = p.clock.Now()
+		return
+	}
+
+	trigger.lastRun = p.clock.Now()
+
+	if p.state == nil {
+		return
+	}
+
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	p.state.BalanceRuns[action.pipline.runStateKey(action.actionIndex)] = trigger.lastRun
+
+	err := p.state.save()
+
+	if err != nil {
+		log.Printf("Failed to save run state: %v", err)
+	}
+}
+
+// saveLastRun records the last successful scheduled run of an action.
+func (p *piplineExecutor) saveLastRun(action *pendingAction, runID string) {
+	if p.state == nil {
+		return
+	}
+
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	p.state.LastRuns[action.pipline.runStateKey(action.actionIndex)] = &lastRun{
+		TriggerTime: action.triggerTime,
+		FinishedAt:  p.clock.Now(),
+		RunID:       runID,
+	}
+
+	err := p.state.save()
+
+	if err != nil {
+		log.Printf("Failed to save run state: %v", err)
 	}
 }
@@ -0,0 +1,511 @@
+package pipline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frimin/pactus-staker/config"
+	"github.com/frimin/pactus-staker/pipline/action"
+	"github.com/frimin/pactus-staker/pipline/action/common"
+	"github.com/frimin/pactus-staker/pipline/provider"
+)
+
+type fakeRun struct {
+	action string
+	runID  string
+	at     time.Time
+	failed bool
+}
+
+// fakeActions creates actions that record their runs instead of sending
+// transactions. result returns the error of an attempt of a run.
+type fakeActions struct {
+	mu     sync.Mutex
+	clock  *fakeClock
+	runs   []fakeRun
+	result func(action, runID string, attempt int) error
+}
+
+type fakeAction struct {
+	actions *fakeActions
+	name    string
+}
+
+func (f *fakeActions) create(_ provider.PiplineProvider, _ int, _ *config.Options, actionConfig *config.Action) (action.Action, error) {
+	return &fakeAction{actions: f, name: actionConfig.Type}, nil
+}
+
+func (a *fakeAction) Run(runID string) error {
+	a.actions.mu.Lock()
+	defer a.actions.mu.Unlock()
+
+	attempt := 1
+
+	for _, run := range a.actions.runs {
+		if run.action == a.name && run.runID == runID {
+			attempt++
+		}
+	}
+
+	var err error
+
+	if a.actions.result != nil {
+		err = a.actions.result(a.name, runID, attempt)
+	}
+
+	a.actions.runs = append(a.actions.runs, fakeRun{
+		action: a.name,
+		runID:  runID,
+		at:     a.actions.clock.Now(),
+		failed: err != nil,
+	})
+
+	return err
+}
+
+func (a *fakeAction) GetName() string {
+	return a.name
+}
+
+func (a *fakeAction) GetValidatorAddresses() []string {
+	return nil
+}
+
+func (a *fakeAction) GetFilter() *common.Filter {
+	return nil
+}
+
+func createTestExecutor(t *testing.T, ctx context.Context, clock *fakeClock, options *config.Options, piplineConfig config.Pipline, actions *fakeActions) (*piplineExecutor, *pipline) {
+	t.Helper()
+
+	pip := newPipline(ctx, clock, piplineConfig.Name)
+
+	err := pip.createActions(options, piplineConfig, actions.create)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := newExecutor(options, []*pipline{pip}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e, pip
+}
+
+// TestExecutorDays runs withdraw then bond every day at 02:30 in New York over
+// the start of daylight saving time, with failing attempts and retries.
+func TestExecutorDays(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 6, 12, 0, 0, 0, newYork)
+	end := time.Date(2026, 3, 10, 0, 0, 0, 0, newYork)
+
+	clock := newFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	actions := &fakeActions{
+		clock: clock,
+		result: func(action, runID string, attempt int) error {
+			if action != "withdraw" {
+				return nil
+			}
+
+			failed := fmt.Errorf("withdraw attempt %d failed", attempt)
+
+			switch runID[:8] {
+			case "20260307":
+				if attempt == 1 {
+					return failed
+				}
+			case "20260308":
+				return failed
+			}
+
+			return nil
+		},
+	}
+
+	options := &config.Options{
+		RetryDelay: []int{60},
+		Timezone:   "America/New_York",
+	}
+
+	e, pip := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name: "daily",
+		Actions: []config.Action{
+			{Type: "withdraw", Time: []string{"02:30"}, Jitter: "30m"},
+			{Type: "bond", Time: []string{"02:30"}, Jitter: "30m", DependsOn: []string{"withdraw"}},
+		},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	for clock.fireNext(1).Before(end) {
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	jittered := func(trigger time.Time) time.Time {
+		a := &pendingAction{pipline: pip, triggerTime: trigger}
+
+		return a.withJitter().runAt()
+	}
+
+	// 02:30 does not exist on 03-08, it runs at 03:30 EDT
+	day1 := jittered(time.Date(2026, 3, 7, 2, 30, 0, 0, newYork))
+	day2 := jittered(time.Date(2026, 3, 8, 3, 30, 0, 0, newYork))
+	day3 := jittered(time.Date(2026, 3, 9, 2, 30, 0, 0, newYork))
+
+	want := []fakeRun{
+		{action: "withdraw", runID: "20260307T0230-0-0", at: day1, failed: true},
+		{action: "withdraw", runID: "20260307T0230-0-0", at: day1.Add(time.Minute)},
+		// same trigger and jitter, so it runs right after the withdraw
+		{action: "bond", runID: "20260307T0230-0-1", at: day1.Add(time.Minute)},
+		{action: "withdraw", runID: "20260308T0330-0-0", at: day2, failed: true},
+		{action: "withdraw", runID: "20260308T0330-0-0", at: day2.Add(time.Minute), failed: true},
+		// the bond is skipped, its dependency did not succeed
+		{action: "withdraw", runID: "20260309T0230-0-0", at: day3},
+		{action: "bond", runID: "20260309T0230-0-1", at: day3},
+	}
+
+	if len(actions.runs) != len(want) {
+		t.Fatalf("got %d runs %v, want %d", len(actions.runs), actions.runs, len(want))
+	}
+
+	for i, run := range actions.runs {
+		if run.action != want[i].action || run.runID != want[i].runID || !run.at.Equal(want[i].at) || run.failed != want[i].failed {
+			t.Errorf("run %d: got %+v, want %+v", i, run, want[i])
+		}
+	}
+
+	for _, day := range []time.Time{day1, day2, day3} {
+		if offset := day.Minute() - 30; day.Hour()%2 == 0 && (offset < 0 || offset >= 30) {
+			t.Errorf("run at %v is outside of the jitter window", day)
+		}
+	}
+
+	withdraw, bond := pip.summaries[0], pip.summaries[1]
+
+	if withdraw.succeeded != 2 || withdraw.failed != 1 {
+		t.Errorf("withdraw summary: %+v", withdraw)
+	}
+
+	if bond.succeeded != 2 || bond.skipped != 1 {
+		t.Errorf("bond summary: %+v", bond)
+	}
+}
+
+// TestExecutorShutdownDuringRetry stops the executor while a failed run waits
+// for its retry.
+func TestExecutorShutdownDuringRetry(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	actions := &fakeActions{
+		clock: clock,
+		result: func(string, string, int) error {
+			return fmt.Errorf("transfer failed")
+		},
+	}
+
+	options := &config.Options{
+		RetryDelay: []int{600},
+		Timezone:   "UTC",
+	}
+
+	e, pip := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name:    "retry",
+		Actions: []config.Action{{Type: "transfer", Every: "1m"}},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	// the first trigger, then the run fails and waits for its retry
+	clock.fireNext(1)
+	clock.blockUntil(1)
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	if len(actions.runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(actions.runs))
+	}
+
+	if summary := pip.summaries[0]; summary.interrupted != 1 || summary.failed != 0 {
+		t.Errorf("summary: %+v", summary)
+	}
+}
+
+// TestExecutorUnconfirmed does not retry a run whose transactions may still be
+// included in a block.
+func TestExecutorUnconfirmed(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	actions := &fakeActions{
+		clock: clock,
+		result: func(string, string, int) error {
+			return fmt.Errorf("bond failed: %w", &common.UnconfirmedError{Err: fmt.Errorf("1 of 1 transactions not confirmed")})
+		},
+	}
+
+	options := &config.Options{
+		RetryDelay: []int{60, 60},
+		Timezone:   "UTC",
+	}
+
+	e, pip := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name:    "unconfirmed",
+		Actions: []config.Action{{Type: "bond", Every: "1m"}},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	// the first trigger, then the next trigger is the only timer left
+	clock.fireNext(1)
+	clock.blockUntil(1)
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	if len(actions.runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(actions.runs))
+	}
+
+	if summary := pip.summaries[0]; summary.failed != 1 {
+		t.Errorf("summary: %+v", summary)
+	}
+}
+
+// TestExecutorDeferred runs a bond that defers part of its work twice, the
+// dependent action runs without waiting for the deferred bonds.
+func TestExecutorDeferred(t *testing.T) {
+	trigger := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(trigger.Add(-time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	actions := &fakeActions{
+		clock: clock,
+		result: func(action, _ string, attempt int) error {
+			if action == "bond" && attempt < 3 {
+				return &common.DeferredError{Reason: "in committee", RetryAfter: 30 * time.Second}
+			}
+
+			return nil
+		},
+	}
+
+	options := &config.Options{
+		RetryDelay: []int{600},
+		Timezone:   "UTC",
+	}
+
+	e, pip := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name: "deferred",
+		Actions: []config.Action{
+			{Type: "bond", Time: []string{"12:00"}},
+			{Type: "transfer", Time: []string{"12:00"}, DependsOn: []string{"bond"}},
+		},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	for clock.fireNext(1).Before(trigger.Add(time.Hour)) {
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	want := []fakeRun{
+		{action: "bond", runID: "20260101T1200-0-0", at: trigger, failed: true},
+		{action: "transfer", runID: "20260101T1200-0-1", at: trigger},
+		// the resumed runs keep the run ID and are not retried as failures
+		{action: "bond", runID: "20260101T1200-0-0", at: trigger.Add(30 * time.Second), failed: true},
+		{action: "bond", runID: "20260101T1200-0-0", at: trigger.Add(time.Minute)},
+	}
+
+	if len(actions.runs) != len(want) {
+		t.Fatalf("got %d runs %v, want %d", len(actions.runs), actions.runs, len(want))
+	}
+
+	for i, run := range actions.runs {
+		if run.action != want[i].action || run.runID != want[i].runID || !run.at.Equal(want[i].at) || run.failed != want[i].failed {
+			t.Errorf("run %d: got %+v, want %+v", i, run, want[i])
+		}
+	}
+
+	if bond := pip.summaries[0]; bond.deferred != 2 || bond.succeeded != 1 || bond.failed != 0 {
+		t.Errorf("bond summary: %+v", bond)
+	}
+
+	if transfer := pip.summaries[1]; transfer.succeeded != 1 {
+		t.Errorf("transfer summary: %+v", transfer)
+	}
+}
+
+// TestExecutorBalanceLastRun starts the minimum interval of the balance trigger
+// from a successful scheduled run, not from a failed one.
+func TestExecutorBalanceLastRun(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	calls := 0
+
+	actions := &fakeActions{
+		clock: clock,
+		// the first run fails, with its retry
+		result: func(string, string, int) error {
+			calls++
+
+			if calls <= 2 {
+				return fmt.Errorf("bond failed")
+			}
+
+			return nil
+		},
+	}
+
+	options := &config.Options{
+		RetryDelay: []int{60},
+		Timezone:   "UTC",
+		StateFile:  filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	e, pip := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name:    "p",
+		Actions: []config.Action{{Type: "bond", Every: "1h", WhenBalanceAbove: 100}},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	for clock.fireNext(1).Before(start.Add(150 * time.Minute)) {
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	trigger := pip.balanceTriggers[0]
+
+	if want := start.Add(time.Hour + time.Minute); !trigger.failedAt.Equal(want) {
+		t.Errorf("failed at: got %v, want %v", trigger.failedAt, want)
+	}
+
+	if want := start.Add(2 * time.Hour); !trigger.lastRun.Equal(want) {
+		t.Errorf("last run: got %v, want %v", trigger.lastRun, want)
+	}
+
+	state, err := loadRunState(options.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved := state.BalanceRuns["p/bond"]; !saved.Equal(trigger.lastRun) {
+		t.Errorf("saved last run: got %v, want %v", saved, trigger.lastRun)
+	}
+}
+
+// TestExecutorWallClockJump runs a daily action on time when the wall clock
+// jumps forward while the executor waits for it.
+func TestExecutorWallClockJump(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	trigger := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	actions := &fakeActions{clock: clock}
+
+	options := &config.Options{
+		RetryDelay: []int{60},
+		Timezone:   "UTC",
+	}
+
+	e, _ := createTestExecutor(t, ctx, clock, options, config.Pipline{
+		Name:    "jump",
+		Actions: []config.Action{{Type: "bond", Time: []string{"12:00"}}},
+	}, actions)
+
+	done := make(chan error)
+
+	go func() {
+		done <- e.Run(ctx)
+	}()
+
+	// the host is suspended for 11h30m once the executor waits
+	clock.blockUntil(1)
+	clock.jump(11*time.Hour + 30*time.Minute)
+
+	for clock.fireNext(1).Before(trigger.Add(time.Hour)) {
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run returned %v", err)
+	}
+
+	if len(actions.runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(actions.runs))
+	}
+
+	if !actions.runs[0].at.Equal(trigger) {
+		t.Errorf("ran at %v, want %v", actions.runs[0].at, trigger)
+	}
+}
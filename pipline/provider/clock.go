@@ -0,0 +1,22 @@
+package provider
+
+import "time"
+
+// Clock is the time source of the executor and the actions. Tests can replace
+// it to simulate days of triggers and retries without waiting.
+type Clock interface {
+	Now() time.Time
+	// After sends the current time on the returned channel once the duration has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the operating system.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -1,6 +1,9 @@
 package provider
 
 import (
+	"context"
+
+	"github.com/pactus-project/pactus/genesis"
 	"github.com/pactus-project/pactus/types/amount"
 	"github.com/pactus-project/pactus/wallet"
 	pactus "github.com/pactus-project/pactus/www/grpc/gen/go"
@@ -8,8 +11,21 @@ import (
 
 type PiplineProvider interface {
 	GetName() string
+	// GetContext is canceled when the process shuts down. Actions must not
+	// start a new transaction once it is canceled.
+	GetContext() context.Context
+	// GetClock is the time source used to wait for transactions and retries
+	GetClock() Clock
 	GetAllBalance() ([]string, []amount.Amount, error)
 	GetAccountWallet(address string) (*wallet.Wallet, string)
+	GetValidatorWallet(address string) (*wallet.Wallet, string)
+	GetAddressLabels() map[string][]string
 	GetBlockchainClient() pactus.BlockchainClient
+	GetBlockchainInfo() (*pactus.GetBlockchainInfoResponse, error)
+	GetCommitteeInfo() (*pactus.GetCommitteeInfoResponse, error)
+	CalculateFee(payloadType pactus.PayloadType) (amount.Amount, error)
+	GetTransaction(id string) (*pactus.GetTransactionResponse, error)
+	GetTxPoolContent() ([]*pactus.TransactionInfo, error)
+	GetConsensusParams() *genesis.GenesisParams
 	GetValidatorStake(address string) (amount.Amount, *pactus.ValidatorInfo, error)
 }
@@ -0,0 +1,87 @@
+package pipline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/frimin/pactus-staker/pipline/action/common"
+)
+
+type lastRun struct {
+	TriggerTime time.Time `json:"trigger_time"`
+	FinishedAt  time.Time `json:"finished_at"`
+	RunID       string    `json:"run_id"`
+}
+
+// runState keeps the last successful scheduled run of each action between
+// restarts, so runs missed while the process was down can be caught up. It
+// also keeps the last run started by the balance trigger of each action, so
+// its minimum interval holds over restarts.
+type runState struct {
+	filename    string
+	LastRuns    map[string]*lastRun  `json:"last_runs"`
+	BalanceRuns map[string]time.Time `json:"balance_runs"`
+}
+
+// runStateKey identifies an action in the run state by its pipline and its
+// name rather than its position, so reordering the actions keeps their state.
+func (p *pipline) runStateKey(actionIndex int) string {
+	return fmt.Sprintf("%s/%s", p.name, p.stateKeys[actionIndex])
+}
+
+func loadRunState(filename string) (*runState, error) {
+	state := &runState{
+		filename:    filename,
+		LastRuns:    make(map[string]*lastRun),
+		BalanceRuns: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read run state: %w", err)
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		// the state only saves catch-up runs and waits, losing it is
+		// better than not starting
+		log.Printf("Failed to parse run state %s, start with an empty state: %v", filename, err)
+
+		return &runState{
+			filename:    filename,
+			LastRuns:    make(map[string]*lastRun),
+			BalanceRuns: make(map[string]time.Time),
+		}, nil
+	}
+
+	if state.LastRuns == nil {
+		state.LastRuns = make(map[string]*lastRun)
+	}
+
+	if state.BalanceRuns == nil {
+		state.BalanceRuns = make(map[string]time.Time)
+	}
+
+	return state, nil
+}
+
+func (s *runState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = common.WriteFileAtomic(s.filename, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package pipline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frimin/pactus-staker/config"
+)
+
+func TestRunStateSaveLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadRunState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finished := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	state.LastRuns["p/bond"] = &lastRun{TriggerTime: finished, FinishedAt: finished, RunID: "20260101T1200-0-0"}
+	state.BalanceRuns["p/bond"] = finished
+
+	err = state.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadRunState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := loaded.LastRuns["p/bond"]; last == nil || last.RunID != "20260101T1200-0-0" || !last.FinishedAt.Equal(finished) {
+		t.Errorf("last run: got %+v", last)
+	}
+
+	if !loaded.BalanceRuns["p/bond"].Equal(finished) {
+		t.Errorf("balance run: got %v", loaded.BalanceRuns["p/bond"])
+	}
+}
+
+func TestRunStateCorrupt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	err := os.WriteFile(filename, []byte(`{"last_runs": {"p/bo`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadRunState(filename)
+	if err != nil {
+		t.Fatalf("a corrupt state must not stop the start: %v", err)
+	}
+
+	if len(state.LastRuns) != 0 || len(state.BalanceRuns) != 0 {
+		t.Errorf("got %+v, want an empty state", state)
+	}
+
+	err = state.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunStateKey(t *testing.T) {
+	actions := &fakeActions{clock: newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))}
+
+	keys := func(actionConfigs []config.Action) map[string]string {
+		pip := newPipline(context.Background(), actions.clock, "p")
+
+		err := pip.createActions(&config.Options{Timezone: "UTC"}, config.Pipline{Name: "p", Actions: actionConfigs}, actions.create)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := make(map[string]string)
+
+		for i, actionConfig := range actionConfigs {
+			result[actionConfig.Name+actionConfig.Type+actionConfig.Every] = pip.runStateKey(i)
+		}
+
+		return result
+	}
+
+	withdraw := config.Action{Type: "withdraw", Every: "1h"}
+	bond := config.Action{Type: "bond", Every: "2h"}
+	secondBond := config.Action{Type: "bond", Every: "3h"}
+	named := config.Action{Name: "daily", Type: "bond", Every: "24h"}
+
+	before := keys([]config.Action{withdraw, bond, secondBond})
+	after := keys([]config.Action{named, bond, withdraw, secondBond})
+
+	want := map[string]string{
+		"withdraw1h": "p/withdraw",
+		"bond2h":     "p/bond",
+		"bond3h":     "p/bond#2",
+	}
+
+	for id, key := range want {
+		if before[id] != key || after[id] != key {
+			t.Errorf("%s: got %q before and %q after the reorder, want %q", id, before[id], after[id], key)
+		}
+	}
+
+	if after["dailybond24h"] != "p/daily" {
+		t.Errorf("named action: got %q", after["dailybond24h"])
+	}
+}
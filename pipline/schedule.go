@@ -0,0 +1,315 @@
+package pipline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is one entry of the time list of an action.
+type schedule interface {
+	// next returns the first trigger time strictly after the given time, in
+	// the location of the given time.
+	next(after time.Time) time.Time
+	String() string
+}
+
+// loadLocation returns the time zone of an action, which overrides the one of
+// the options. The local time zone of the host is used if neither is set.
+func loadLocation(optionsTimezone, actionTimezone string) (*time.Location, error) {
+	name := actionTimezone
+
+	if name == "" {
+		name = optionsTimezone
+	}
+
+	if name == "" {
+		return time.Local, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+
+	return location, nil
+}
+
+// maxShift is larger than any daylight saving time shift of the zone database.
+const maxShift = 3 * time.Hour
+
+// localTime is time.Date for wall clocks skipped by daylight saving time: they
+// are moved forward by the size of the gap, so 02:30 on the day the clock jumps
+// from 02:00 to 03:00 becomes 03:30, like cron does.
+func localTime(year int, month time.Month, day, hour, minute int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+
+	if t.Hour() == hour%24 && t.Minute() == minute%60 {
+		return t
+	}
+
+	_, before := t.Zone()
+	_, after := t.Add(maxShift).Zone()
+
+	return t.Add(time.Duration(after-before) * time.Second)
+}
+
+// parseSchedule accepts a daily "HH:MM" time or a 5-field cron expression
+// "minute hour day-of-month month day-of-week".
+func parseSchedule(spec string) (schedule, error) {
+	fields := strings.Fields(spec)
+
+	switch len(fields) {
+	case 1:
+		t, err := time.Parse("15:04", fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q, expected HH:MM or a cron expression", spec)
+		}
+
+		return &dailySchedule{hour: t.Hour(), minute: t.Minute()}, nil
+	case 5:
+		return parseCron(spec, fields)
+	default:
+		return nil, fmt.Errorf("invalid time %q, expected HH:MM or a cron expression", spec)
+	}
+}
+
+// intervalSchedule triggers every interval. The trigger times are aligned to
+// absolute time (to UTC midnight for intervals that divide a day), so they do
+// not move when the process restarts.
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func parseInterval(spec string) (*intervalSchedule, error) {
+	interval, err := time.ParseDuration(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", spec, err)
+	}
+
+	if interval < time.Minute {
+		return nil, fmt.Errorf("invalid interval %q: must be at least 1m", spec)
+	}
+
+	return &intervalSchedule{interval: interval}, nil
+}
+
+func (s *intervalSchedule) next(after time.Time) time.Time {
+	return after.Truncate(s.interval).Add(s.interval)
+}
+
+func (s *intervalSchedule) String() string {
+	return "every " + s.interval.String()
+}
+
+// nextBlockTrigger returns the first multiple of everyBlocks above height.
+func nextBlockTrigger(height, everyBlocks uint32) uint32 {
+	return (height/everyBlocks + 1) * everyBlocks
+}
+
+type dailySchedule struct {
+	hour   int
+	minute int
+}
+
+// next compares the resolved times, so a time skipped by daylight saving time
+// runs once at the shifted time, even when after is inside the gap, and a
+// repeated time runs only once. The day before is checked too, as a shift can
+// move its time past midnight.
+func (s *dailySchedule) next(after time.Time) time.Time {
+	for day := -1; ; day++ {
+		t := localTime(after.Year(), after.Month(), after.Day()+day, s.hour, s.minute, after.Location())
+
+		if t.After(after) {
+			return t
+		}
+	}
+}
+
+func (s *dailySchedule) String() string {
+	return fmt.Sprintf("%02d:%02d", s.hour, s.minute)
+}
+
+type cronSchedule struct {
+	spec    string
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// 7 is accepted for Sunday as well
+	cronDow = cronField{min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+func parseCron(spec string, fields []string) (*cronSchedule, error) {
+	s := &cronSchedule{
+		spec:    spec,
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+
+	targets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+
+	for i, field := range []cronField{cronMinute, cronHour, cronDom, cronMonth, cronDow} {
+		bits, err := field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+
+		*targets[i] = bits
+	}
+
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 << 0
+	}
+
+	return s, nil
+}
+
+// parse returns the allowed values of a field as a bit set. It supports "*",
+// values, names, ranges "a-b", steps "*/n" and "a-b/n" and comma separated lists.
+func (f cronField) parse(expr string) (uint64, error) {
+	bits := uint64(0)
+
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+
+		low, high := f.min, f.max
+
+		if rangeExpr != "*" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+
+			var err error
+
+			low, err = f.value(lowExpr)
+			if err != nil {
+				return 0, err
+			}
+
+			high = low
+
+			if isRange {
+				high, err = f.value(highExpr)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+
+			if high < low {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func (f cronField) value(expr string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(expr, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", expr, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<t.Weekday()) != 0
+
+	// like cron, if both day fields are restricted a day matching either one is enough
+	if !s.domStar && !s.dowStar {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
+
+// next walks the wall clock in UTC, which has no daylight saving time, and
+// converts the match to the location of after. A time skipped by daylight
+// saving time runs once at the shifted time and a repeated time runs only once.
+// The walk starts maxShift before after, so a time skipped just before after
+// is still found at its shifted time.
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, time.UTC).Add(-maxShift)
+	// an expression like "0 0 30 2 *" never matches, give up after a few years
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<t.Month()) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		local := localTime(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), after.Location())
+
+		if !local.After(after) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return local
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,137 @@
+package pipline
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily later today", "12:00", utc(2026, 1, 1, 10, 0), utc(2026, 1, 1, 12, 0)},
+		{"daily is strictly after", "12:00", utc(2026, 1, 1, 12, 0), utc(2026, 1, 2, 12, 0)},
+		{"daily month rollover", "00:00", utc(2026, 1, 31, 23, 59), utc(2026, 2, 1, 0, 0)},
+		{"step", "*/15 * * * *", utc(2026, 1, 1, 10, 7), utc(2026, 1, 1, 10, 15)},
+		{"step hour rollover", "*/15 * * * *", utc(2026, 1, 1, 10, 45), utc(2026, 1, 1, 11, 0)},
+		{"range with step", "0 9-17/4 * * *", utc(2026, 1, 1, 10, 0), utc(2026, 1, 1, 13, 0)},
+		{"value with step", "0 9/4 * * *", utc(2026, 1, 1, 17, 0), utc(2026, 1, 1, 21, 0)},
+		{"range next day", "30 8-10 * * *", utc(2026, 1, 1, 10, 30), utc(2026, 1, 2, 8, 30)},
+		{"list", "0 6,18 * * *", utc(2026, 1, 1, 6, 0), utc(2026, 1, 1, 18, 0)},
+		// 2026-01-01 is a Thursday
+		{"weekday names", "0 12 * * mon,fri", utc(2026, 1, 1, 0, 0), utc(2026, 1, 2, 12, 0)},
+		{"weekday name range", "0 12 * * MON-wed", utc(2026, 1, 1, 0, 0), utc(2026, 1, 5, 12, 0)},
+		{"month names", "0 0 1 mar,jun *", utc(2026, 1, 1, 0, 0), utc(2026, 3, 1, 0, 0)},
+		{"sunday as 0", "0 0 * * 0", utc(2026, 1, 1, 0, 0), utc(2026, 1, 4, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", utc(2026, 1, 1, 0, 0), utc(2026, 1, 4, 0, 0)},
+		{"weekday range to 7", "0 0 * * 6-7", utc(2026, 1, 1, 0, 0), utc(2026, 1, 3, 0, 0)},
+		{"day of month", "0 0 13 * *", utc(2026, 1, 1, 0, 0), utc(2026, 1, 13, 0, 0)},
+		{"day of month or weekday", "0 0 13 * fri", utc(2026, 1, 1, 0, 0), utc(2026, 1, 2, 0, 0)},
+		{"day of month or weekday next friday", "0 0 13 * fri", utc(2026, 1, 2, 0, 0), utc(2026, 1, 9, 0, 0)},
+		{"day of month or weekday the 13th", "0 0 13 * fri", utc(2026, 1, 9, 0, 0), utc(2026, 1, 13, 0, 0)},
+		{"weekday with day of month star", "0 0 * * fri", utc(2026, 1, 9, 0, 0), utc(2026, 1, 16, 0, 0)},
+		{"month rollover skips short months", "0 0 31 * *", utc(2026, 1, 31, 0, 0), utc(2026, 3, 31, 0, 0)},
+		{"year rollover", "0 0 1 1 *", utc(2026, 1, 1, 0, 0), utc(2027, 1, 1, 0, 0)},
+		{"year rollover at new year eve", "*/30 * * * *", utc(2026, 12, 31, 23, 30), utc(2027, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2026, 1, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never matches", "0 0 30 2 *", utc(2026, 1, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.next(tt.after)
+
+			if !got.Equal(tt.want) {
+				t.Errorf("%q after %v: got %v, want %v", tt.spec, tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"25:00",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"0 0 * foo *",
+		"0 0 * * 1-",
+	} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, newYork)
+	}
+
+	// on 2026-03-08 the clock jumps from 02:00 EST to 03:00 EDT,
+	// on 2026-11-01 it goes back from 02:00 EDT to 01:00 EST
+	fallBackEDT := time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC).In(newYork)
+	fallBackEST := time.Date(2026, 11, 1, 6, 10, 0, 0, time.UTC).In(newYork)
+
+	tests := []struct {
+		name  string
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily skipped runs shifted", "02:30", local(3, 8, 1, 0), local(3, 8, 3, 30)},
+		{"daily skipped runs shifted when started in the gap", "02:30", local(3, 8, 3, 10), local(3, 8, 3, 30)},
+		{"daily skipped runs once", "02:30", local(3, 8, 3, 30), local(3, 9, 2, 30)},
+		{"daily after the jump", "03:15", local(3, 8, 1, 50), local(3, 8, 3, 15)},
+		{"daily repeated runs at the first time", "01:30", local(11, 1, 0, 0), fallBackEDT},
+		{"daily repeated runs once", "01:30", fallBackEDT, local(11, 2, 1, 30)},
+		{"daily repeated runs once when started in the second hour", "01:30", fallBackEST, local(11, 2, 1, 30)},
+		{"cron skipped runs shifted", "30 2 * * *", local(3, 8, 1, 0), local(3, 8, 3, 30)},
+		{"cron skipped runs shifted when started in the gap", "30 2 * * *", local(3, 8, 3, 10), local(3, 8, 3, 30)},
+		{"cron skipped runs once", "30 2 * * *", local(3, 8, 3, 30), local(3, 9, 2, 30)},
+		{"cron hourly over the jump", "0 * * * *", local(3, 8, 1, 0), local(3, 8, 3, 0)},
+		{"cron hourly after the jump", "0 * * * *", local(3, 8, 3, 0), local(3, 8, 4, 0)},
+		{"cron repeated runs at the first time", "30 1 * * *", local(11, 1, 0, 0), fallBackEDT},
+		{"cron repeated runs once", "30 1 * * *", fallBackEDT, local(11, 2, 1, 30)},
+		{"cron repeated runs once when started in the second hour", "30 1 * * *", fallBackEST, local(11, 2, 1, 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.next(tt.after)
+
+			if !got.Equal(tt.want) {
+				t.Errorf("%q after %v: got %v, want %v", tt.spec, tt.after, got, tt.want)
+			}
+		})
+	}
+}